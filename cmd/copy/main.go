@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+const usage = `Usage: copy [flags] <publisherName>...
+
+Copies each publisher's messages from one store to another. Stores are
+given as KIND:LOCATION, where KIND is one of:
+
+  dynamodb  a DynamoDB table, e.g. dynamodb:rivulet
+  file      a JSON-lines file, e.g. file:messages.jsonl
+  log       a segmented log directory, e.g. log:./messages
+  sqlite    a SQLite database file, e.g. sqlite:rivulet.db
+
+`
+
+func main() {
+	src := flag.String("src", "", "store to copy from")
+	dst := flag.String("dst", "", "store to copy to")
+	from := flag.Int("from", 0, "first order to copy")
+	to := flag.Int("to", 0, "last order to copy (0 means no limit)")
+	region := flag.String("region", "", "AWS region of any DynamoDB table (defaults to the AWS configuration)")
+	resume := flag.Bool("resume", false, "resume after the last order already in the destination")
+	verify := flag.Bool("verify", false, "count the messages in both stores once copied")
+	pageSize := flag.Int("page-size", store.DefaultCopyPageSize, "messages copied at a time")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *src == "" || *dst == "" || len(flag.Args()) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	source, err := openStore(ctx, *src, *region)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opening %s: %v\n", *src, err)
+		os.Exit(1)
+	}
+	defer closeStore(source)
+	destination, err := openStore(ctx, *dst, *region)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opening %s: %v\n", *dst, err)
+		os.Exit(1)
+	}
+	defer closeStore(destination)
+
+	opts := []store.CopyOptions{
+		store.WithPageSize(*pageSize),
+		store.WithProgress(func(s store.CopyStats) {
+			fmt.Fprintf(os.Stderr, "%s: copied %d messages up to order %d\n", s.Publisher, s.Copied, s.Last)
+		}),
+	}
+	if *resume {
+		opts = append(opts, store.WithResume())
+	}
+	if *verify {
+		opts = append(opts, store.WithVerify())
+	}
+	stats, err := store.Replicate(ctx, destination, source, flag.Args(), store.Range{From: *from, To: *to}, opts...)
+	for _, s := range stats {
+		line := fmt.Sprintf("%s: copied %d messages", s.Publisher, s.Copied)
+		if s.Resumed > 0 {
+			line += fmt.Sprintf(", resuming after order %d", s.Resumed)
+		}
+		if *verify {
+			line += fmt.Sprintf("; source holds %d, destination holds %d", s.Source, s.Destination)
+		}
+		fmt.Println(line)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		closeStore(source)
+		closeStore(destination)
+		os.Exit(1)
+	}
+}
+
+// openStore opens the store described by spec, as KIND:LOCATION.
+func openStore(ctx context.Context, spec, region string) (store.Store, error) {
+	kind, location, ok := strings.Cut(spec, ":")
+	if !ok || location == "" {
+		return nil, fmt.Errorf("want KIND:LOCATION, got %q", spec)
+	}
+	switch kind {
+	case "dynamodb":
+		var opts []func(*config.LoadOptions) error
+		if region != "" {
+			opts = append(opts, config.WithRegion(region))
+		}
+		cfg, err := config.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return store.NewDynamoDBStore(store.WithAWSConfig(cfg), store.WithTable(location))
+	case "file":
+		return store.NewFileStore(location)
+	case "log":
+		return store.NewLogStore(location)
+	case "sqlite":
+		return store.NewSQLiteStore(location)
+	}
+	return nil, fmt.Errorf("unknown store kind %q", kind)
+}
+
+// closeStore closes the store if it holds files open.
+func closeStore(s store.Store) {
+	if c, ok := s.(io.Closer); ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/mr-joshcrane/rivulet"
+)
+
+const usage = `Usage: infra <command> [flags]
+
+Manages the AWS infrastructure that receives a publisher's events: an
+EventBridge Rule targeting a Lambda function that saves messages to a
+DynamoDB table. The commands are:
+
+  plan     show the changes apply would make
+  apply    create or update the infrastructure
+  destroy  remove the rule, its targets and the function
+  verify   report how the deployed infrastructure differs from the flags,
+           exiting with status 1 if it does
+
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var infra rivulet.InfraConfig
+	flags.StringVar(&infra.Account, "account", "", "AWS account to deploy to")
+	flags.StringVar(&infra.Region, "region", "", "AWS region to deploy to (defaults to the AWS configuration)")
+	flags.StringVar(&infra.EventBusName, "bus", "", `event bus the rule is on (default "default")`)
+	flags.StringVar(&infra.RuleName, "rule", "", "name of the rule (defaults to the function name)")
+	flags.StringVar(&infra.RulePattern, "pattern", "", "event pattern of the rule (default "+rivulet.DefaultRulePattern+")")
+	flags.StringVar(&infra.RuleRole, "rule-role", "", "IAM role the rule assumes to invoke the function, if any")
+	flags.StringVar(&infra.Table, "table", "", `DynamoDB table messages are saved to (default "rivulet")`)
+	flags.BoolVar(&infra.DeleteTable, "delete-table", false, "make destroy delete the table and every message in it")
+	flags.StringVar(&infra.FunctionName, "function", "", "name of the Lambda function")
+	flags.StringVar(&infra.ExecutionRole, "execution-role", "", `IAM role the function runs as (default "rivulet-lambda-role")`)
+	flags.StringVar(&infra.CodePath, "code", "", `Go source of the function's main package (default "cmd/lambda/main.go")`)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[2:])
+	switch command {
+	case "plan", "apply", "destroy", "verify":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var opts []func(*config.LoadOptions) error
+	if infra.Region != "" {
+		opts = append(opts, config.WithRegion(infra.Region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load AWS config: %v\n", err)
+		os.Exit(1)
+	}
+	if infra.Region == "" {
+		infra.Region = cfg.Region
+	}
+	i, err := rivulet.NewInfrastructure(infra, rivulet.WithInfraAWSConfig(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	switch command {
+	case "plan":
+		plan, err := i.Plan(ctx)
+		exitOnError(err)
+		fmt.Println(plan)
+	case "apply":
+		applied, err := i.Apply(ctx)
+		fmt.Println(applied)
+		exitOnError(err)
+	case "destroy":
+		destroyed, err := i.Destroy(ctx)
+		fmt.Println(destroyed)
+		exitOnError(err)
+	case "verify":
+		report, err := i.Verify(ctx)
+		exitOnError(err)
+		fmt.Println(report)
+		if len(report) > 0 {
+			os.Exit(1)
+		}
+	}
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -12,16 +12,23 @@ import (
 )
 
 func handler(ctx context.Context, event events.EventBridgeEvent) error {
-	store := store.NewDynamoDBStore()
-	s := rivulet.NewEventBridgeSubscriber(event, store)
-	err := s.Receive(ctx)
+	table := os.Getenv(rivulet.TableEnvironmentVariable)
+	if table == "" {
+		table = store.DefaultTable
+	}
+	store, err := store.NewDynamoDBStore(store.WithTable(table), store.WithIdempotentWrites())
 	if err != nil {
 		return err
 	}
+	s := rivulet.NewEventBridgeSubscriber(event, store)
 	var msg rivulet.Message
-	err = json.Unmarshal([]byte(event.Detail), &msg)
+	s.Handle(func(ctx context.Context, m rivulet.Message) error {
+		msg = m
+		return nil
+	})
+	err = s.Receive(ctx)
 	if err != nil {
-		fmt.Println("Error unmarshalling message", err)
+		fmt.Println("Error receiving message", err)
 		return err
 	}
 	fmt.Println("Received message", msg)
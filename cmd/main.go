@@ -1,38 +1,34 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
-)
+	"os"
+	"time"
 
-type RivuletEvent struct {
-	Detail struct {
-		Message string `json:"message"`
-	} `json:"detail"`
-}
+	"github.com/mr-joshcrane/rivulet"
+)
 
 func main() {
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		data, err := io.ReadAll(r.Body)
+	receiver := rivulet.NewNetworkReceiver()
+	go func() {
+		err := http.ListenAndServe(":8080", receiver)
 		if err != nil {
-			fmt.Println(err)
-			return
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-		defer r.Body.Close()
-		var event RivuletEvent
-		err = json.Unmarshal(data, &event)
+	}()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		messages, err := receiver.Receive(ctx)
+		cancel()
 		if err != nil {
 			fmt.Println(err)
-			return
+			continue
+		}
+		for _, m := range messages {
+			fmt.Printf("%s %d: %s\n", m.Publisher, m.Order, m.Content)
 		}
-		fmt.Println(event.Detail.Message)
-
-	}
-	http.HandleFunc("/", handler)
-	err := http.ListenAndServe(":8080", nil)
-	if err != nil {
-		fmt.Println(err)
 	}
 }
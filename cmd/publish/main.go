@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,11 +12,6 @@ import (
 	"github.com/mr-joshcrane/rivulet"
 )
 
-type runState struct {
-	ID    string `json:"id"`
-	Order int    `json:"order"`
-}
-
 func main() {
 	source := envOrDefault("RIVULET_SOURCE", "rivulet")
 	bus := envOrDefault("RIVULET_BUS", "default")
@@ -35,10 +29,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	state := loadOrCreateState(name, runID)
-	state.Order++
-	saveState(name, state)
-
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to load AWS config: %v\n", err)
@@ -48,40 +38,19 @@ func main() {
 
 	client := eventbridge.NewFromConfig(cfg)
 
-	rivulet.DefaultTransform = func(m rivulet.Message) (string, error) {
-		data, err := json.Marshal(m)
-		if err != nil {
-			return "", err
-		}
-		envelope := struct {
-			Detail string `json:"detail"`
-			Type   string `json:"type"`
-		}{
-			Type:   "rivulet",
-			Detail: string(data),
-		}
-		out, err := json.Marshal(envelope)
-		if err != nil {
-			return "", err
-		}
-		return string(out), nil
-	}
-
-	publisher := rivulet.NewEventBridgePublisher(
-		name+" "+state.ID,
-		client,
-		rivulet.WithSource(source),
-		rivulet.WithEventBusName(bus),
-		rivulet.WithDetailType("notification"),
-		rivulet.WithTransform(rivulet.DefaultTransform),
+	publisher := rivulet.NewPublisher(
+		name+" "+runID,
+		rivulet.WithEventBridgeTransport(
+			client,
+			rivulet.WithSource(source),
+			rivulet.WithEventBusName(bus),
+			rivulet.WithDetailType("notification"),
+			rivulet.WithTransform(rivulet.EnvelopeTransform("rivulet")),
+		),
+		rivulet.WithSequenceSource(rivulet.NewFileSequence(sequencePath(name))),
 	)
 
-	msg := rivulet.Message{
-		Publisher: name + " " + state.ID,
-		Order:     state.Order,
-		Content:   message,
-	}
-	if err := publisher.Transport.Publish(msg); err != nil {
+	if err := publisher.Publish(message); err != nil {
 		fmt.Fprintf(os.Stderr, "failed to publish: %v\n", err)
 		os.Exit(1)
 	}
@@ -94,27 +63,7 @@ func envOrDefault(key, fallback string) string {
 	return fallback
 }
 
-func statePath(name string) string {
-	return filepath.Join(os.TempDir(), fmt.Sprintf("rivulet-%s.json", name))
-}
-
-func loadOrCreateState(name, runID string) runState {
-	data, err := os.ReadFile(statePath(name))
-	if err != nil {
-		return runState{ID: runID, Order: 0}
-	}
-	var state runState
-	if json.Unmarshal(data, &state) != nil {
-		return runState{ID: runID, Order: 0}
-	}
-	state.ID = runID
-	return state
-}
-
-func saveState(name string, state runState) {
-	data, err := json.Marshal(state)
-	if err != nil {
-		return
-	}
-	os.WriteFile(statePath(name), data, 0644)
+// sequencePath is where the orders of each run's messages are kept between invocations.
+func sequencePath(name string) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("rivulet-%s.sequence.json", name))
 }
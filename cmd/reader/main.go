@@ -2,26 +2,231 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strconv"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/mr-joshcrane/rivulet"
+	"github.com/mr-joshcrane/rivulet/store"
 )
 
+// pageSize is how many messages are read from the store at a time.
+const pageSize = 1000
+
 func main() {
+	follow := flag.Bool("follow", false, "keep reading new messages as they are stored, like tail -f")
+	from := flag.Int("from", 0, "first order to read")
+	to := flag.Int("to", 0, "last order to read (0 means no limit)")
+	since := flag.Duration("since", 0, "only show messages published within this duration, e.g. 1h")
+	table := flag.String("table", store.DefaultTable, "DynamoDB table to read from")
+	region := flag.String("region", "", "AWS region of the table (defaults to the AWS configuration)")
+	format := flag.String("format", "plain", "output format: plain, jsonl or csv")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: reader [flags] <publisherName>")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	if len(flag.Args()) != 1 {
-		fmt.Println("Usage: rivulet <publisherName>")
+		flag.Usage()
+		os.Exit(2)
+	}
+	publisher := flag.Arg(0)
+	out, err := newOutput(*format, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var opts []func(*config.LoadOptions) error
+	if *region != "" {
+		opts = append(opts, config.WithRegion(*region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load AWS config: %v\n", err)
 		os.Exit(1)
 	}
-	ctx := context.Background()
-	result, err := rivulet.Read(ctx, os.Args[1], flag.)
+	s, err := store.NewDynamoDBStore(store.WithAWSConfig(cfg), store.WithTable(*table))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	for _, message := range result {
-		fmt.Println(message)
+
+	if *since > 0 {
+		*from, err = sinceOrder(ctx, s, publisher, store.Range{From: *from, To: *to}, time.Now().Add(-*since))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *follow {
+		err = followMessages(ctx, s, publisher, *from, *to, out)
+	} else {
+		err = readMessages(ctx, s, publisher, store.Range{From: *from, To: *to}, out)
+	}
+	if flushErr := out.flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// readMessages shows each message in the range, a page at a time.
+func readMessages(ctx context.Context, s store.Store, publisher string, r store.Range, out output) error {
+	return store.Pages(ctx, s, publisher, r, pageSize, func(messages []store.Message) error {
+		for _, m := range messages {
+			err := out.write(rivulet.FromStoreMessage(m))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// errCutoffFound stops sinceOrder paging once it reaches the cutoff.
+var errCutoffFound = errors.New("cutoff found")
+
+// sinceOrder returns the first order in the range of the messages published
+// since the cutoff. It reads the range newest first, so only the messages
+// published since the cutoff, and at most a page more, are read.
+func sinceOrder(ctx context.Context, s store.Store, publisher string, r store.Range, cutoff time.Time) (int, error) {
+	from := r.From
+	r.Reverse = true
+	err := store.Pages(ctx, s, publisher, r, pageSize, func(messages []store.Message) error {
+		for _, m := range messages {
+			if m.Timestamp.Before(cutoff) {
+				from = m.Order + 1
+				return errCutoffFound
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errCutoffFound) {
+		return 0, err
+	}
+	return from, nil
+}
+
+// followMessages shows each message from order from onwards as it is stored,
+// until ctx is cancelled or, if to is set, the message with that order is shown.
+func followMessages(ctx context.Context, s store.Store, publisher string, from, to int, out output) error {
+	if to > 0 && from > to {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r := rivulet.NewReader(publisher, rivulet.WithStore(s))
+	r.CurrentMessage = max(from-1, 0)
+	f := r.Follow(ctx)
+	for m := range f.Messages() {
+		if to > 0 && m.Order > to {
+			break
+		}
+		err := out.write(m)
+		if err == nil {
+			err = out.flush()
+		}
+		if err != nil {
+			return err
+		}
+		if to > 0 && m.Order == to {
+			break
+		}
+	}
+	cancel()
+	for range f.Messages() {
 	}
+	return f.Err()
+}
+
+// output writes messages in one of the supported formats.
+type output interface {
+	write(rivulet.Message) error
+	flush() error
+}
+
+func newOutput(format string, w io.Writer) (output, error) {
+	switch format {
+	case "plain":
+		return plainOutput{w}, nil
+	case "jsonl":
+		return jsonOutput{json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvOutput{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q: want plain, jsonl or csv", format)
+}
+
+// plainOutput writes the content of each message on a line of its own.
+type plainOutput struct {
+	w io.Writer
+}
+
+func (o plainOutput) write(m rivulet.Message) error {
+	_, err := fmt.Fprintln(o.w, m.Content)
+	return err
+}
+
+func (o plainOutput) flush() error {
+	return nil
+}
+
+// jsonOutput writes each message with its metadata as a line of JSON.
+type jsonOutput struct {
+	enc *json.Encoder
+}
+
+func (o jsonOutput) write(m rivulet.Message) error {
+	return o.enc.Encode(m)
+}
+
+func (o jsonOutput) flush() error {
+	return nil
+}
+
+// csvOutput writes each message with its metadata as a CSV record,
+// after a header row. Headers are written as a JSON object.
+type csvOutput struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (o *csvOutput) write(m rivulet.Message) error {
+	if !o.header {
+		err := o.w.Write([]string{"publisher", "order", "id", "timestamp", "headers", "content"})
+		if err != nil {
+			return err
+		}
+		o.header = true
+	}
+	var timestamp, headers string
+	if !m.Timestamp.IsZero() {
+		timestamp = m.Timestamp.Format(time.RFC3339Nano)
+	}
+	if len(m.Headers) > 0 {
+		data, err := json.Marshal(m.Headers)
+		if err != nil {
+			return err
+		}
+		headers = string(data)
+	}
+	return o.w.Write([]string{m.Publisher, strconv.Itoa(m.Order), m.ID, timestamp, headers, m.Content})
+}
+
+func (o *csvOutput) flush() error {
+	o.w.Flush()
+	return o.w.Error()
 }
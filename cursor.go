@@ -0,0 +1,115 @@
+package rivulet
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Cursor checkpoints how far a [Reader] has got through a publisher's stream,
+// so that a reader resuming after a crash picks up exactly after the last
+// Order it processed. Each checkpoint is kept under a key naming the reader.
+type Cursor interface {
+	// Load returns the last Order committed under key, or zero if there is none.
+	Load(ctx context.Context, key string) (int, error)
+	// Save commits order as the last Order processed under key.
+	Save(ctx context.Context, key string, order int) error
+}
+
+// FileCursor is a [Cursor] that persists its checkpoints as a JSON object in
+// a file. The file is rewritten atomically on every Save.
+// A FileCursor must not be shared between processes.
+type FileCursor struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileCursor creates a [FileCursor] backed by the file at path.
+// The file is created on the first Save if it doesn't exist.
+func NewFileCursor(path string) *FileCursor {
+	return &FileCursor{path: path}
+}
+
+// Load returns the checkpoint saved under key.
+func (c *FileCursor) Load(_ context.Context, key string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	checkpoints, err := readCounters(c.path)
+	if err != nil {
+		return 0, err
+	}
+	return checkpoints[key], nil
+}
+
+// Save persists order as the checkpoint under key before returning.
+func (c *FileCursor) Save(_ context.Context, key string, order int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	checkpoints, err := readCounters(c.path)
+	if err != nil {
+		return err
+	}
+	checkpoints[key] = order
+	return writeCounters(c.path, checkpoints)
+}
+
+// DynamoDBCursorClient is the subset of the DynamoDB API used by a [DynamoDBCursor].
+type DynamoDBCursorClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBCursor is a [Cursor] that keeps one checkpoint item per key in a
+// DynamoDB table, so that a reader can resume on a different host.
+// The table needs a string partition key named Reader.
+type DynamoDBCursor struct {
+	client DynamoDBCursorClient
+	table  string
+}
+
+// NewDynamoDBCursor creates a [DynamoDBCursor] that keeps its checkpoints in the given table.
+func NewDynamoDBCursor(client DynamoDBCursorClient, table string) *DynamoDBCursor {
+	return &DynamoDBCursor{
+		client: client,
+		table:  table,
+	}
+}
+
+// Load reads the checkpoint item for key with a strongly consistent read.
+func (c *DynamoDBCursor) Load(ctx context.Context, key string) (int, error) {
+	out, err := c.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.table),
+		Key: map[string]types.AttributeValue{
+			"Reader": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if out.Item == nil {
+		return 0, nil
+	}
+	order, ok := out.Item["Order"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, fmt.Errorf("cursor item for %q has no Order number attribute", key)
+	}
+	return strconv.Atoi(order.Value)
+}
+
+// Save writes the checkpoint item for key.
+func (c *DynamoDBCursor) Save(ctx context.Context, key string, order int) error {
+	_, err := c.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(c.table),
+		Item: map[string]types.AttributeValue{
+			"Reader": &types.AttributeValueMemberS{Value: key},
+			"Order":  &types.AttributeValueMemberN{Value: strconv.Itoa(order)},
+		},
+	})
+	return err
+}
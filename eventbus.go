@@ -0,0 +1,201 @@
+package rivulet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/google/uuid"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+// EventBus is an in-process emulation of AWS EventBridge, for testing the
+// whole path from a [Publisher] through EventBridge Rules to a [Subscriber]
+// without AWS. It implements [EventBridgeClient], so it can be given to
+// [WithEventBridgeTransport] in place of a real client.
+//
+// Events put on a bus are matched against the bus's rules, and delivered
+// to each target of every matching rule before PutEvents returns.
+type EventBus struct {
+	mu       sync.Mutex
+	rules    map[string][]*eventRule
+	failures []error
+
+	// Account and Region are stamped on every event, as EventBridge does.
+	Account string
+	Region  string
+}
+
+// EventTarget receives the events routed to it by an [EventBus] rule, as a
+// Lambda function targeted by an EventBridge Rule would.
+type EventTarget func(ctx context.Context, event events.EventBridgeEvent) error
+
+type eventRule struct {
+	name    string
+	pattern *Pattern
+	targets []EventTarget
+}
+
+// NewEventBus creates an [EventBus] with no rules.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		rules:   map[string][]*eventRule{},
+		Account: "123456789012",
+		Region:  "us-east-1",
+	}
+}
+
+// PutRule creates or replaces the rule named name on the event bus busName,
+// routing events that match the event pattern. Replacing a rule keeps its targets.
+func (b *EventBus) PutRule(busName, name, pattern string) error {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range b.rules[busName] {
+		if r.name == name {
+			r.pattern = p
+			return nil
+		}
+	}
+	b.rules[busName] = append(b.rules[busName], &eventRule{name: name, pattern: p})
+	return nil
+}
+
+// AddTarget adds a target to the rule named name on the event bus busName.
+func (b *EventBus) AddTarget(busName, name string, target EventTarget) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range b.rules[busName] {
+		if r.name == name {
+			r.targets = append(r.targets, target)
+			return nil
+		}
+	}
+	return fmt.Errorf("rule %s does not exist on event bus %s", name, busName)
+}
+
+// PutEvents puts each entry on its event bus and delivers it to the targets
+// of every matching rule. As with EventBridge, malformed entries are reported
+// as failed entries in the output rather than failing the call, and a target
+// failing to handle an event doesn't fail the entry; see [EventBus.Failures].
+func (b *EventBus) PutEvents(ctx context.Context, input *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	if len(input.Entries) == 0 || len(input.Entries) > maxEventBridgeBatch {
+		return nil, fmt.Errorf("PutEvents takes between 1 and %d entries, got %d", maxEventBridgeBatch, len(input.Entries))
+	}
+	out := &eventbridge.PutEventsOutput{}
+	for _, entry := range input.Entries {
+		event, err := b.event(entry)
+		if err != nil {
+			out.FailedEntryCount++
+			out.Entries = append(out.Entries, ebTypes.PutEventsResultEntry{
+				ErrorCode:    aws.String("MalformedDetail"),
+				ErrorMessage: aws.String(err.Error()),
+			})
+			continue
+		}
+		err = b.route(ctx, busName(entry), event)
+		if err != nil {
+			return nil, err
+		}
+		out.Entries = append(out.Entries, ebTypes.PutEventsResultEntry{EventId: aws.String(event.ID)})
+	}
+	return out, nil
+}
+
+func busName(entry ebTypes.PutEventsRequestEntry) string {
+	if aws.ToString(entry.EventBusName) == "" {
+		return "default"
+	}
+	return aws.ToString(entry.EventBusName)
+}
+
+// event builds the event EventBridge would deliver for the entry.
+func (b *EventBus) event(entry ebTypes.PutEventsRequestEntry) (events.EventBridgeEvent, error) {
+	if aws.ToString(entry.Source) == "" {
+		return events.EventBridgeEvent{}, errors.New("entry has no Source")
+	}
+	if aws.ToString(entry.DetailType) == "" {
+		return events.EventBridgeEvent{}, errors.New("entry has no DetailType")
+	}
+	var detail map[string]any
+	err := json.Unmarshal([]byte(aws.ToString(entry.Detail)), &detail)
+	if err != nil {
+		return events.EventBridgeEvent{}, errors.New("entry Detail is not a JSON object")
+	}
+	at := time.Now().UTC()
+	if entry.Time != nil {
+		at = entry.Time.UTC()
+	}
+	return events.EventBridgeEvent{
+		Version:    "0",
+		ID:         uuid.NewString(),
+		DetailType: aws.ToString(entry.DetailType),
+		Source:     aws.ToString(entry.Source),
+		AccountID:  b.Account,
+		Time:       at,
+		Region:     b.Region,
+		Resources:  entry.Resources,
+		Detail:     json.RawMessage(aws.ToString(entry.Detail)),
+	}, nil
+}
+
+// route delivers the event to the targets of every rule on the bus it matches.
+func (b *EventBus) route(ctx context.Context, bus string, event events.EventBridgeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	var targets []EventTarget
+	var names []string
+	for _, r := range b.rules[bus] {
+		ok, err := r.pattern.Match(data)
+		if err != nil {
+			b.mu.Unlock()
+			return err
+		}
+		if ok {
+			for _, t := range r.targets {
+				targets = append(targets, t)
+				names = append(names, r.name)
+			}
+		}
+	}
+	b.mu.Unlock()
+	for i, target := range targets {
+		err := target(ctx, event)
+		if err != nil {
+			b.mu.Lock()
+			b.failures = append(b.failures, fmt.Errorf("rule %s delivering event %s: %w", names[i], event.ID, err))
+			b.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// Failures returns the errors targets have returned so far, which
+// EventBridge would have retried and eventually sent to a dead-letter queue.
+func (b *EventBus) Failures() []error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]error(nil), b.failures...)
+}
+
+// SubscriberTarget returns an [EventTarget] that receives each event with an
+// [EventBridgeReceiver] and saves it to the store, as the Lambda function
+// in cmd/lambda does.
+func SubscriberTarget(s store.Store, opts ...EventBridgeReceiverOptions) EventTarget {
+	return func(ctx context.Context, event events.EventBridgeEvent) error {
+		return NewEventBridgeSubscriber(event, s, opts...).Receive(ctx)
+	}
+}
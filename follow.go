@@ -0,0 +1,121 @@
+package rivulet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+const (
+	// DefaultPollInterval is how soon a [Follower] checks its store again
+	// after finding nothing new.
+	DefaultPollInterval = 100 * time.Millisecond
+	// DefaultMaxPollInterval is the longest a [Follower] backs off between
+	// checks of a quiet store.
+	DefaultMaxPollInterval = 5 * time.Second
+)
+
+// WithPollInterval is a functional option specifying how often a [Follower]
+// polls its store for new messages. Each poll that finds nothing doubles
+// the interval, from min up to max, and any new message resets it to min.
+func WithPollInterval(min, max time.Duration) ReaderOptions {
+	return func(r *Reader) {
+		r.pollMin = min
+		r.pollMax = max
+	}
+}
+
+// Follower tails a publisher's stream, delivering each message on a channel
+// as it lands in the store, like tail -f.
+type Follower struct {
+	messages chan Message
+	err      error
+}
+
+// Follow tails the publisher's stream in s from the beginning, or from the
+// position committed to a [Cursor] given with [WithCursor].
+// See [Reader.Follow].
+func Follow(ctx context.Context, s store.Store, publisherName string, opts ...ReaderOptions) *Follower {
+	r := NewReader(publisherName, append([]ReaderOptions{WithStore(s)}, opts...)...)
+	return r.Follow(ctx)
+}
+
+// Follow starts tailing the Reader's stream until ctx is cancelled.
+// Messages are delivered in order and without gaps, as they are by Next.
+// If the store implements [store.Notifier], the Follower wakes as soon as
+// a message is saved; otherwise it polls with backoff, see [WithPollInterval].
+// Each batch is committed to the Reader's [Cursor], if it has one, once all
+// of its messages have been received from the channel.
+//
+// The Reader must not be used by anything else while it is being followed.
+func (r *Reader) Follow(ctx context.Context) *Follower {
+	f := &Follower{messages: make(chan Message)}
+	go f.run(ctx, r)
+	return f
+}
+
+// Messages returns the channel on which the Follower delivers messages.
+// It is closed when the Follower stops.
+func (f *Follower) Messages() <-chan Message {
+	return f.messages
+}
+
+// Err returns the error that stopped the Follower, or nil if it stopped
+// because its context was cancelled. It is only valid once the channel
+// returned by Messages has been closed.
+func (f *Follower) Err() error {
+	return f.err
+}
+
+func (f *Follower) run(ctx context.Context, r *Reader) {
+	defer close(f.messages)
+	r.applyDefaults()
+	notifier, _ := r.Store.(store.Notifier)
+	delay := r.pollMin
+	for {
+		// Ask to be notified before reading, so that a message saved
+		// between the read and the wait still wakes the Follower.
+		var notify <-chan struct{}
+		if notifier != nil {
+			notify = notifier.Notify(r.PublisherName)
+		}
+		messages, err := r.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				f.err = fmt.Errorf("following %s: %w", r.PublisherName, err)
+			}
+			return
+		}
+		for _, msg := range messages {
+			select {
+			case f.messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(messages) > 0 {
+			err = r.Commit(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					f.err = fmt.Errorf("following %s: %w", r.PublisherName, err)
+				}
+				return
+			}
+			delay = r.pollMin
+			continue
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-notify:
+			timer.Stop()
+			delay = r.pollMin
+		case <-timer.C:
+			delay = min(delay*2, r.pollMax)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
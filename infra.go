@@ -3,113 +3,888 @@ package rivulet
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	ebTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
-	"github.com/google/go-cmp/cmp"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/google/uuid"
 	"github.com/mr-joshcrane/glambda"
+	"github.com/mr-joshcrane/rivulet/store"
 )
 
-func (r EventBridgeReceiver) Receive(ctx context.Context) ([]Message, error) {
-	var message Message
-	err := json.Unmarshal(r.event.Detail, &message)
+// Receive returns the message carried by the event the first time it is called.
+// The event holds no more messages after that, so later calls wait for the
+// context to be done and return nothing.
+func (r *EventBridgeReceiver) Receive(ctx context.Context) ([]Message, error) {
+	if r.delivered {
+		<-ctx.Done()
+		return []Message{}, nil
+	}
+	message, err := r.decode(r.event.Detail)
 	if err != nil {
-		return []Message{}, err
+		return []Message{}, fmt.Errorf("decoding event %s: %w", r.event.ID, err)
 	}
+	r.delivered = true
 	return []Message{message}, nil
 }
 
-func SetupEventBridgeReceiverInfrastructure(cfg aws.Config, p *Publisher) error {
-	err := createLambdaFunction(cfg, p.name)
+// Drain returns the message carried by the event if Receive hasn't already
+// returned it, without waiting.
+func (r *EventBridgeReceiver) Drain() ([]Message, error) {
+	if r.delivered {
+		return []Message{}, nil
+	}
+	return r.Receive(context.Background())
+}
+
+// InfraConfig describes the AWS infrastructure that receives a publisher's
+// events: an EventBridge Rule on an event bus, targeting a Lambda function
+// that saves the messages it is invoked with to a DynamoDB table.
+// Fields left empty, other than Account, Region and FunctionName, take the
+// defaults described on each.
+type InfraConfig struct {
+	// Account and Region are where the infrastructure is deployed.
+	Account string
+	Region  string
+	// EventBusName is the event bus the Rule is on, "default" by default.
+	EventBusName string
+	// RuleName is the name of the Rule, FunctionName by default.
+	RuleName string
+	// RulePattern is the event pattern of the Rule, [DefaultRulePattern] by default.
+	RulePattern string
+	// RuleRole is the name of an IAM role the Rule assumes to invoke its
+	// target, if it needs one.
+	RuleRole string
+	// Table is the DynamoDB table messages are saved to, [store.DefaultTable] by default.
+	Table string
+	// DeleteTable makes Destroy delete the table, and every message in it.
+	DeleteTable bool
+	// FunctionName is the name of the Lambda function.
+	FunctionName string
+	// ExecutionRole is the name of the IAM role the function runs as,
+	// "rivulet-lambda-role" by default.
+	ExecutionRole string
+	// CodePath is the Go source file of the function's main package,
+	// "cmd/lambda/main.go" by default.
+	CodePath string
+}
+
+// withDefaults returns the config with every empty field that has a default set to it.
+func (c InfraConfig) withDefaults() InfraConfig {
+	defaults := []struct {
+		field *string
+		value string
+	}{
+		{&c.EventBusName, "default"},
+		{&c.RuleName, c.FunctionName},
+		{&c.RulePattern, DefaultRulePattern},
+		{&c.Table, store.DefaultTable},
+		{&c.ExecutionRole, "rivulet-lambda-role"},
+		{&c.CodePath, "cmd/lambda/main.go"},
+	}
+	for _, d := range defaults {
+		if *d.field == "" {
+			*d.field = d.value
+		}
+	}
+	return c
+}
+
+// Validate reports whether the config is complete, and its RulePattern
+// one EventBridge would accept.
+func (c InfraConfig) Validate() error {
+	var errs []error
+	for _, required := range []struct{ name, value string }{
+		{"Account", c.Account},
+		{"Region", c.Region},
+		{"FunctionName", c.FunctionName},
+	} {
+		if required.value == "" {
+			errs = append(errs, fmt.Errorf("%s must be set", required.name))
+		}
+	}
+	if c.RulePattern != "" {
+		_, err := ParsePattern(c.RulePattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", c.RuleName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FunctionARN is the ARN of the Lambda function.
+func (c InfraConfig) FunctionARN() string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", c.Region, c.Account, c.FunctionName)
+}
+
+// executionRoleARN is the ARN of the role the function runs as.
+func (c InfraConfig) executionRoleARN() string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", c.Account, c.ExecutionRole)
+}
+
+// ruleRoleARN is the ARN of the role the Rule assumes, if it has one.
+func (c InfraConfig) ruleRoleARN() *string {
+	if c.RuleRole == "" {
+		return nil
+	}
+	return aws.String(fmt.Sprintf("arn:aws:iam::%s:role/%s", c.Account, c.RuleRole))
+}
+
+// InfraEventBridgeClient is the part of the EventBridge API used to manage a Rule.
+type InfraEventBridgeClient interface {
+	DescribeRule(ctx context.Context, params *eventbridge.DescribeRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeRuleOutput, error)
+	PutRule(ctx context.Context, params *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error)
+	DeleteRule(ctx context.Context, params *eventbridge.DeleteRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DeleteRuleOutput, error)
+	ListTargetsByRule(ctx context.Context, params *eventbridge.ListTargetsByRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListTargetsByRuleOutput, error)
+	PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error)
+	RemoveTargets(ctx context.Context, params *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error)
+}
+
+// InfraLambdaClient is the part of the Lambda API used to manage a function.
+// Functions are deployed by a [FunctionDeployer].
+type InfraLambdaClient interface {
+	GetFunction(ctx context.Context, params *lambda.GetFunctionInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error)
+	DeleteFunction(ctx context.Context, params *lambda.DeleteFunctionInput, optFns ...func(*lambda.Options)) (*lambda.DeleteFunctionOutput, error)
+}
+
+// InfraDynamoDBClient is the part of the DynamoDB API used to manage a
+// table, and to check that messages reach it.
+type InfraDynamoDBClient interface {
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// FunctionDeployer builds the Lambda function from its code and creates
+// or updates it, along with its execution role and the permission for
+// EventBridge to invoke it.
+type FunctionDeployer interface {
+	Deploy(ctx context.Context, config InfraConfig) error
+}
+
+// InfraAction is what a plan does to a resource.
+type InfraAction string
+
+const (
+	InfraCreate InfraAction = "create"
+	InfraUpdate InfraAction = "update"
+	InfraDelete InfraAction = "delete"
+)
+
+// InfraChange is a change to one resource.
+type InfraChange struct {
+	Action   InfraAction
+	Resource string
+	Name     string
+	Reason   string
+}
+
+func (c InfraChange) String() string {
+	s := fmt.Sprintf("%s %s %s", c.Action, c.Resource, c.Name)
+	if c.Reason != "" {
+		s += ": " + c.Reason
+	}
+	return s
+}
+
+// InfraPlan is the changes needed to bring the deployed infrastructure in
+// line with an [InfraConfig], in the order they are made.
+type InfraPlan []InfraChange
+
+func (p InfraPlan) String() string {
+	if len(p) == 0 {
+		return "no changes"
+	}
+	lines := make([]string, len(p))
+	for i, c := range p {
+		lines[i] = c.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Resources an InfraChange applies to.
+const (
+	resourceTable    = "table"
+	resourceFunction = "function"
+	resourceRule     = "rule"
+	resourceTarget   = "target"
+)
+
+// Infrastructure plans, applies and destroys the infrastructure an
+// [InfraConfig] describes.
+type Infrastructure struct {
+	config      InfraConfig
+	cfg         *aws.Config
+	eventBridge InfraEventBridgeClient
+	lambda      InfraLambdaClient
+	dynamoDB    InfraDynamoDBClient
+	deployer    FunctionDeployer
+}
+
+// InfrastructureOptions are functional options for configuring an [Infrastructure].
+type InfrastructureOptions func(*Infrastructure)
+
+// WithInfraAWSConfig is a functional option specifying the AWS configuration
+// an [Infrastructure] creates its clients from, instead of the default
+// configuration for the config's Region.
+func WithInfraAWSConfig(cfg aws.Config) InfrastructureOptions {
+	return func(i *Infrastructure) {
+		i.cfg = &cfg
+	}
+}
+
+// WithInfraClients is a functional option specifying the clients an
+// [Infrastructure] manages resources with. No AWS configuration is loaded
+// when every client and the deployer are given.
+func WithInfraClients(eb InfraEventBridgeClient, l InfraLambdaClient, ddb InfraDynamoDBClient) InfrastructureOptions {
+	return func(i *Infrastructure) {
+		i.eventBridge = eb
+		i.lambda = l
+		i.dynamoDB = ddb
+	}
+}
+
+// WithFunctionDeployer is a functional option specifying how an
+// [Infrastructure] deploys the Lambda function.
+func WithFunctionDeployer(d FunctionDeployer) InfrastructureOptions {
+	return func(i *Infrastructure) {
+		i.deployer = d
+	}
+}
+
+// NewInfrastructure creates an [Infrastructure] for the config, once it
+// has been validated. Clients not given with [WithInfraClients] are created
+// from the AWS configuration given with [WithInfraAWSConfig], or else from
+// the default configuration, and the function is deployed with glambda
+// unless another [FunctionDeployer] is given.
+func NewInfrastructure(cfg InfraConfig, opts ...InfrastructureOptions) (*Infrastructure, error) {
+	cfg = cfg.withDefaults()
+	err := cfg.Validate()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("invalid infrastructure config: %w", err)
+	}
+	i := &Infrastructure{config: cfg}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.eventBridge != nil && i.lambda != nil && i.dynamoDB != nil && i.deployer != nil {
+		return i, nil
+	}
+	if i.cfg == nil {
+		awsCfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(cfg.Region))
+		if err != nil {
+			return nil, err
+		}
+		i.cfg = &awsCfg
+	}
+	if i.eventBridge == nil {
+		i.eventBridge = eventbridge.NewFromConfig(*i.cfg)
+	}
+	if i.lambda == nil {
+		i.lambda = lambda.NewFromConfig(*i.cfg)
 	}
-	functionName := fmt.Sprintf("arn:aws:lambda:%s:265693559009:function:%s", cfg.Region, p.name)
-	err = createEventBridgeRule(cfg, p.name, functionName)
+	if i.dynamoDB == nil {
+		i.dynamoDB = dynamodb.NewFromConfig(*i.cfg)
+	}
+	if i.deployer == nil {
+		i.deployer = glambdaDeployer{cfg: *i.cfg}
+	}
+	return i, nil
+}
+
+// Config returns the config the Infrastructure was created with, with its defaults filled in.
+func (i *Infrastructure) Config() InfraConfig {
+	return i.config
+}
+
+// Plan compares the deployed infrastructure with the config, and returns
+// the changes Apply would make. The function is always updated, as its
+// code can't be compared without building it.
+func (i *Infrastructure) Plan(ctx context.Context) (InfraPlan, error) {
+	c := i.config
+	var plan InfraPlan
+	exists, err := i.tableExists(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	timestamp := fmt.Sprint(time.Now().Unix())
-	err = p.Transport.Publish(Message{
-		Publisher: p.name,
-		Order:     0,
-		Content:   timestamp,
+	if !exists {
+		plan = append(plan, InfraChange{Action: InfraCreate, Resource: resourceTable, Name: c.Table})
+	}
+	_, err = i.lambda.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String(c.FunctionName)})
+	switch {
+	case isNotFound(err):
+		plan = append(plan, InfraChange{Action: InfraCreate, Resource: resourceFunction, Name: c.FunctionName})
+	case err != nil:
+		return nil, fmt.Errorf("getting function %s: %w", c.FunctionName, err)
+	default:
+		plan = append(plan, InfraChange{Action: InfraUpdate, Resource: resourceFunction, Name: c.FunctionName, Reason: "deploy code from " + c.CodePath})
+	}
+	rule, err := i.eventBridge.DescribeRule(ctx, &eventbridge.DescribeRuleInput{
+		Name:         aws.String(c.RuleName),
+		EventBusName: aws.String(c.EventBusName),
 	})
+	switch {
+	case isNotFound(err):
+		plan = append(plan,
+			InfraChange{Action: InfraCreate, Resource: resourceRule, Name: c.RuleName},
+			InfraChange{Action: InfraCreate, Resource: resourceTarget, Name: c.FunctionARN()},
+		)
+		return plan, nil
+	case err != nil:
+		return nil, fmt.Errorf("describing rule %s: %w", c.RuleName, err)
+	}
+	reason, err := i.ruleDrift(rule)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		plan = append(plan, InfraChange{Action: InfraUpdate, Resource: resourceRule, Name: c.RuleName, Reason: reason})
+	}
+	targets, err := i.targets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !hasTarget(targets, c.FunctionARN()) {
+		plan = append(plan, InfraChange{Action: InfraCreate, Resource: resourceTarget, Name: c.FunctionARN()})
+	}
+	return plan, nil
+}
+
+// Apply makes the changes planned by Plan, and returns them.
+func (i *Infrastructure) Apply(ctx context.Context) (InfraPlan, error) {
+	plan, err := i.Plan(ctx)
 	if err != nil {
+		return nil, err
+	}
+	for n, change := range plan {
+		err := i.apply(ctx, change)
+		if err != nil {
+			return plan[:n], fmt.Errorf("%s: %w", change, err)
+		}
+	}
+	return plan, nil
+}
+
+func (i *Infrastructure) apply(ctx context.Context, change InfraChange) error {
+	c := i.config
+	switch change.Resource {
+	case resourceTable:
+		_, err := i.dynamoDB.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName: aws.String(c.Table),
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String(store.DefaultAttributeNames.Publisher), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String(store.DefaultAttributeNames.Order), AttributeType: types.ScalarAttributeTypeN},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String(store.DefaultAttributeNames.Publisher), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String(store.DefaultAttributeNames.Order), KeyType: types.KeyTypeRange},
+			},
+			BillingMode: types.BillingModePayPerRequest,
+		})
+		if err != nil {
+			return err
+		}
+		return dynamodb.NewTableExistsWaiter(i.dynamoDB).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(c.Table)}, tableWait)
+	case resourceFunction:
+		return i.deployer.Deploy(ctx, c)
+	case resourceRule:
+		_, err := i.eventBridge.PutRule(ctx, &eventbridge.PutRuleInput{
+			Name:         aws.String(c.RuleName),
+			EventBusName: aws.String(c.EventBusName),
+			EventPattern: aws.String(c.RulePattern),
+			State:        ebTypes.RuleStateEnabled,
+			RoleArn:      c.ruleRoleARN(),
+		})
 		return err
+	case resourceTarget:
+		out, err := i.eventBridge.PutTargets(ctx, &eventbridge.PutTargetsInput{
+			Rule:         aws.String(c.RuleName),
+			EventBusName: aws.String(c.EventBusName),
+			Targets: []ebTypes.Target{{
+				Arn: aws.String(c.FunctionARN()),
+				Id:  aws.String(c.FunctionName),
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		if out.FailedEntryCount > 0 {
+			return fmt.Errorf("target rejected: %s", aws.ToString(out.FailedEntries[0].ErrorMessage))
+		}
+		return nil
 	}
-	time.Sleep(5 * time.Second)
-	c := dynamodb.NewFromConfig(cfg)
-	result, err := c.Query(context.Background(), &dynamodb.QueryInput{
-		TableName:              aws.String("rivulet"),
-		KeyConditionExpression: aws.String("Publisher = :publisher AND #Order = :order"),
-		ExpressionAttributeNames: map[string]string{
-			"#Order": "Order",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":publisher": &types.AttributeValueMemberS{Value: p.name},
-			":order":     &types.AttributeValueMemberN{Value: "0"},
-		},
+	return fmt.Errorf("unknown resource %q", change.Resource)
+}
+
+// Destroy removes the Rule, its targets and the function, and the table
+// if DeleteTable is set, returning the changes made. Resources that don't
+// exist are skipped, so Destroy can be run again after a partial failure.
+func (i *Infrastructure) Destroy(ctx context.Context) (InfraPlan, error) {
+	c := i.config
+	var done InfraPlan
+	targets, err := i.targets(ctx)
+	if err != nil && !isNotFound(err) {
+		return done, err
+	}
+	if len(targets) > 0 {
+		ids := make([]string, len(targets))
+		for n, t := range targets {
+			ids[n] = aws.ToString(t.Id)
+		}
+		_, err := i.eventBridge.RemoveTargets(ctx, &eventbridge.RemoveTargetsInput{
+			Rule:         aws.String(c.RuleName),
+			EventBusName: aws.String(c.EventBusName),
+			Ids:          ids,
+		})
+		if err != nil {
+			return done, fmt.Errorf("removing targets of rule %s: %w", c.RuleName, err)
+		}
+		for _, t := range targets {
+			done = append(done, InfraChange{Action: InfraDelete, Resource: resourceTarget, Name: aws.ToString(t.Arn)})
+		}
+	}
+	_, err = i.eventBridge.DeleteRule(ctx, &eventbridge.DeleteRuleInput{
+		Name:         aws.String(c.RuleName),
+		EventBusName: aws.String(c.EventBusName),
 	})
+	switch {
+	case err == nil:
+		done = append(done, InfraChange{Action: InfraDelete, Resource: resourceRule, Name: c.RuleName})
+	case !isNotFound(err):
+		return done, fmt.Errorf("deleting rule %s: %w", c.RuleName, err)
+	}
+	_, err = i.lambda.DeleteFunction(ctx, &lambda.DeleteFunctionInput{FunctionName: aws.String(c.FunctionName)})
+	switch {
+	case err == nil:
+		done = append(done, InfraChange{Action: InfraDelete, Resource: resourceFunction, Name: c.FunctionName})
+	case !isNotFound(err):
+		return done, fmt.Errorf("deleting function %s: %w", c.FunctionName, err)
+	}
+	if !c.DeleteTable {
+		return done, nil
+	}
+	_, err = i.dynamoDB.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(c.Table)})
+	switch {
+	case err == nil:
+		done = append(done, InfraChange{Action: InfraDelete, Resource: resourceTable, Name: c.Table})
+	case !isNotFound(err):
+		return done, fmt.Errorf("deleting table %s: %w", c.Table, err)
+	}
+	return done, nil
+}
+
+// Drift is one way the deployed infrastructure differs from its [InfraConfig].
+type Drift struct {
+	Resource string
+	Name     string
+	Problem  string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s %s: %s", d.Resource, d.Name, d.Problem)
+}
+
+// DriftReport is every way the deployed infrastructure differs from its
+// [InfraConfig]. An empty report means it matches.
+type DriftReport []Drift
+
+func (r DriftReport) String() string {
+	if len(r) == 0 {
+		return "no drift"
+	}
+	lines := make([]string, len(r))
+	for i, d := range r {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Verify checks the deployed table, function, Rule and targets against the
+// config, reporting anything missing or different. Unlike Plan, it looks
+// at how the function is configured, and reports targets the config
+// doesn't expect. It doesn't change anything.
+func (i *Infrastructure) Verify(ctx context.Context) (DriftReport, error) {
+	var report DriftReport
+	for _, check := range []func(context.Context) (DriftReport, error){
+		i.verifyTable,
+		i.verifyFunction,
+		i.verifyRule,
+	} {
+		drift, err := check(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, drift...)
+	}
+	return report, nil
+}
+
+func (i *Infrastructure) verifyTable(ctx context.Context) (DriftReport, error) {
+	c := i.config
+	drift := func(problem string, args ...any) Drift {
+		return Drift{Resource: resourceTable, Name: c.Table, Problem: fmt.Sprintf(problem, args...)}
+	}
+	out, err := i.dynamoDB.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(c.Table)})
+	if isNotFound(err) {
+		return DriftReport{drift("missing")}, nil
+	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("describing table %s: %w", c.Table, err)
+	}
+	var report DriftReport
+	if out.Table.TableStatus != types.TableStatusActive {
+		report = append(report, drift("status is %s", out.Table.TableStatus))
+	}
+	want := map[string]types.KeyType{
+		store.DefaultAttributeNames.Publisher: types.KeyTypeHash,
+		store.DefaultAttributeNames.Order:     types.KeyTypeRange,
 	}
-	if len(result.Items) == 0 {
-		return fmt.Errorf("no items found")
+	got := map[string]types.KeyType{}
+	for _, k := range out.Table.KeySchema {
+		got[aws.ToString(k.AttributeName)] = k.KeyType
 	}
-	if len(result.Items) > 1 {
-		return fmt.Errorf("multiple items found")
+	if !reflect.DeepEqual(want, got) {
+		report = append(report, drift("key schema is %v, want %v", got, want))
+	}
+	return report, nil
+}
+
+func (i *Infrastructure) verifyFunction(ctx context.Context) (DriftReport, error) {
+	c := i.config
+	drift := func(problem string, args ...any) Drift {
+		return Drift{Resource: resourceFunction, Name: c.FunctionName, Problem: fmt.Sprintf(problem, args...)}
+	}
+	out, err := i.lambda.GetFunction(ctx, &lambda.GetFunctionInput{FunctionName: aws.String(c.FunctionName)})
+	if isNotFound(err) {
+		return DriftReport{drift("missing")}, nil
 	}
-	messages, err := ParseQueryResults(result)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("getting function %s: %w", c.FunctionName, err)
 	}
-	if !cmp.Equal(messages, []string{timestamp}) {
-		return fmt.Errorf("expected %s, got %s", timestamp, messages)
+	fn := out.Configuration
+	if fn == nil {
+		return DriftReport{drift("has no configuration")}, nil
 	}
-	return nil
+	var report DriftReport
+	if arn := aws.ToString(fn.FunctionArn); arn != c.FunctionARN() {
+		report = append(report, drift("is %s, want %s", arn, c.FunctionARN()))
+	}
+	if fn.State != "" && fn.State != lambdaTypes.StateActive {
+		report = append(report, drift("state is %s", fn.State))
+	}
+	if role := aws.ToString(fn.Role); role != c.executionRoleARN() {
+		report = append(report, drift("runs as role %s, want %s", role, c.executionRoleARN()))
+	}
+	var table string
+	if fn.Environment != nil {
+		table = fn.Environment.Variables[TableEnvironmentVariable]
+	}
+	if table == "" {
+		table = store.DefaultTable
+	}
+	if table != c.Table {
+		report = append(report, drift("saves to table %s, want %s", table, c.Table))
+	}
+	return report, nil
 }
 
-func createEventBridgeRule(cfg aws.Config, name string, targetARN string) error {
-	// Create EventBridge Rule
-	client := eventbridge.NewFromConfig(cfg)
-	out, err := client.PutRule(context.Background(), &eventbridge.PutRuleInput{
-		Name:         aws.String(name),
-		EventPattern: aws.String(`{"source": ["rivulet"], "detail-type": ["rivulet"]}`),
-		State:        ebTypes.RuleStateEnabled,
-		RoleArn:      aws.String("arn:aws:iam::265693559009:role/testrole"),
+func (i *Infrastructure) verifyRule(ctx context.Context) (DriftReport, error) {
+	c := i.config
+	rule, err := i.eventBridge.DescribeRule(ctx, &eventbridge.DescribeRuleInput{
+		Name:         aws.String(c.RuleName),
+		EventBusName: aws.String(c.EventBusName),
 	})
+	if isNotFound(err) {
+		return DriftReport{{Resource: resourceRule, Name: c.RuleName, Problem: "missing"}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("describing rule %s: %w", c.RuleName, err)
+	}
+	var report DriftReport
+	reason, err := i.ruleDrift(rule)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		report = append(report, Drift{Resource: resourceRule, Name: c.RuleName, Problem: reason})
+	}
+	targets, err := i.targets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !hasTarget(targets, c.FunctionARN()) {
+		report = append(report, Drift{Resource: resourceTarget, Name: c.FunctionARN(), Problem: "missing"})
+	}
+	for _, t := range targets {
+		if aws.ToString(t.Arn) != c.FunctionARN() {
+			report = append(report, Drift{Resource: resourceTarget, Name: aws.ToString(t.Arn), Problem: "not in config"})
+		}
+	}
+	return report, nil
+}
+
+func (i *Infrastructure) tableExists(ctx context.Context) (bool, error) {
+	_, err := i.dynamoDB.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(i.config.Table)})
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("describing table %s: %w", i.config.Table, err)
+	}
+	return true, nil
+}
+
+// ruleDrift describes how the deployed rule differs from the config, if it does.
+func (i *Infrastructure) ruleDrift(rule *eventbridge.DescribeRuleOutput) (string, error) {
+	same, err := samePattern(aws.ToString(rule.EventPattern), i.config.RulePattern)
+	if err != nil {
+		return "", err
+	}
+	var reasons []string
+	if !same {
+		reasons = append(reasons, fmt.Sprintf("event pattern is %s, want %s", aws.ToString(rule.EventPattern), i.config.RulePattern))
+	}
+	if rule.State != ebTypes.RuleStateEnabled {
+		reasons = append(reasons, fmt.Sprintf("state is %s", rule.State))
+	}
+	if aws.ToString(rule.RoleArn) != aws.ToString(i.config.ruleRoleARN()) {
+		reasons = append(reasons, fmt.Sprintf("role is %q, want %q", aws.ToString(rule.RoleArn), aws.ToString(i.config.ruleRoleARN())))
+	}
+	return strings.Join(reasons, "; "), nil
+}
+
+// targets lists every target of the Rule.
+func (i *Infrastructure) targets(ctx context.Context) ([]ebTypes.Target, error) {
+	var targets []ebTypes.Target
+	input := &eventbridge.ListTargetsByRuleInput{
+		Rule:         aws.String(i.config.RuleName),
+		EventBusName: aws.String(i.config.EventBusName),
+	}
+	for {
+		out, err := i.eventBridge.ListTargetsByRule(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("listing targets of rule %s: %w", i.config.RuleName, err)
+		}
+		targets = append(targets, out.Targets...)
+		if out.NextToken == nil {
+			return targets, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+func hasTarget(targets []ebTypes.Target, arn string) bool {
+	for _, t := range targets {
+		if aws.ToString(t.Arn) == arn {
+			return true
+		}
+	}
+	return false
+}
+
+// samePattern reports whether two event patterns are the same JSON, however formatted.
+func samePattern(a, b string) (bool, error) {
+	var x, y any
+	err := json.Unmarshal([]byte(a), &x)
+	if err != nil {
+		return false, fmt.Errorf("invalid event pattern %s: %w", a, err)
+	}
+	err = json.Unmarshal([]byte(b), &y)
+	if err != nil {
+		return false, fmt.Errorf("invalid event pattern %s: %w", b, err)
+	}
+	return reflect.DeepEqual(x, y), nil
+}
+
+// isNotFound reports whether the error is AWS saying a resource doesn't exist.
+func isNotFound(err error) bool {
+	var eb *ebTypes.ResourceNotFoundException
+	var l *lambdaTypes.ResourceNotFoundException
+	var ddb *types.ResourceNotFoundException
+	return errors.As(err, &eb) || errors.As(err, &l) || errors.As(err, &ddb)
+}
+
+// tableWait bounds how long Apply waits for a new table to become active.
+const tableWait = 5 * time.Minute
+
+// glambdaDeployer deploys the function with glambda, then points it at the config's table.
+type glambdaDeployer struct {
+	cfg aws.Config
+}
+
+func (d glambdaDeployer) Deploy(ctx context.Context, c InfraConfig) error {
+	inlinePolicy := glambda.WithInlinePolicy(`{"Version": "2012-10-17","Statement":{"Effect": "Allow","Action": "dynamodb:*","Resource": "*"}}`)
+	executionRole := glambda.WithExecutionRole(c.ExecutionRole, inlinePolicy)
+	resourcePolicy := glambda.WithResourcePolicy("events.amazonaws.com")
+	err := glambda.NewLambda(c.FunctionName, c.CodePath, executionRole, resourcePolicy, glambda.WithAWSConfig(d.cfg)).Deploy()
 	if err != nil {
 		return err
 	}
-	_, err = client.PutTargets(context.Background(), &eventbridge.PutTargetsInput{
-		Rule: aws.String(name),
-		Targets: []ebTypes.Target{
-			{
-				Arn: aws.String(targetARN),
-				Id:  aws.String("1"),
-			},
-		},
+	client := lambda.NewFromConfig(d.cfg)
+	name := &lambda.GetFunctionInput{FunctionName: aws.String(c.FunctionName)}
+	err = lambda.NewFunctionUpdatedV2Waiter(client).Wait(ctx, name, time.Minute)
+	if err != nil {
+		return err
+	}
+	fn, err := client.GetFunction(ctx, name)
+	if err != nil {
+		return err
+	}
+	// The update replaces the whole environment, so keep any other variables.
+	variables := map[string]string{}
+	if fn.Configuration != nil && fn.Configuration.Environment != nil {
+		for k, v := range fn.Configuration.Environment.Variables {
+			variables[k] = v
+		}
+	}
+	variables[TableEnvironmentVariable] = c.Table
+	_, err = client.UpdateFunctionConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String(c.FunctionName),
+		Environment:  &lambdaTypes.Environment{Variables: variables},
+	})
+	if err != nil {
+		return err
+	}
+	// Until the update lands, the function still runs with its old environment.
+	return lambda.NewFunctionUpdatedV2Waiter(client).Wait(ctx, name, time.Minute)
+}
+
+// TableEnvironmentVariable names the environment variable telling the
+// Lambda function in cmd/lambda which table to save messages to.
+const TableEnvironmentVariable = "RIVULET_TABLE"
+
+// DefaultSetupTimeout is how long SetupEventBridgeReceiverInfrastructure
+// waits for its probe message to reach the table.
+const DefaultSetupTimeout = 30 * time.Second
+
+// SetupEventBridgeReceiverInfrastructure applies the infrastructure config
+// for the publisher, naming the function after the publisher unless the
+// config names it, and then checks it works end to end by publishing a
+// probe message and waiting for it to be saved to the table.
+//
+// The probe is published under a publisher of its own, named after the
+// publisher with a unique suffix, so that it never takes the place of one
+// of the publisher's messages and a re-run never collides with an earlier
+// probe. It is deleted from the table once it has arrived.
+//
+// The [InfrastructureOptions] are applied after the AWS configuration,
+// so they can give the clients to use instead, as [NewInfrastructure] takes them.
+func SetupEventBridgeReceiverInfrastructure(cfg aws.Config, p *Publisher, infra InfraConfig, opts ...InfrastructureOptions) error {
+	i, err := publisherInfrastructure(cfg, p, infra, opts)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSetupTimeout+tableWait)
+	defer cancel()
+	_, err = i.Apply(ctx)
+	if err != nil {
+		return err
+	}
+	probe := Message{
+		Publisher: p.name + "-probe-" + uuid.NewString(),
+		Content:   fmt.Sprint(time.Now().Unix()),
+	}
+	err = p.Transport.Publish(probe)
+	if err != nil {
+		return err
+	}
+	table := i.Config().Table
+	err = awaitMessage(ctx, i.dynamoDB, table, probe)
+	_, deleteErr := i.dynamoDB.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key:       probeKey(probe),
 	})
 	if err != nil {
 		return err
 	}
-	_, err = json.Marshal(out)
+	if deleteErr != nil {
+		return fmt.Errorf("deleting probe message %s from table %s: %w", probe.Publisher, table, deleteErr)
+	}
+	return nil
+}
+
+// probeKey is the key of the probe message in a table using the
+// [store.DefaultAttributeNames].
+func probeKey(probe Message) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		store.DefaultAttributeNames.Publisher: &types.AttributeValueMemberS{Value: probe.Publisher},
+		store.DefaultAttributeNames.Order:     &types.AttributeValueMemberN{Value: fmt.Sprint(probe.Order)},
+	}
+}
+
+// awaitMessage polls the table until the probe message has been saved,
+// backing off between attempts.
+func awaitMessage(ctx context.Context, c InfraDynamoDBClient, table string, probe Message) error {
+	ctx, cancel := context.WithTimeout(ctx, DefaultSetupTimeout)
+	defer cancel()
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("#publisher = :publisher AND #order = :order"),
+		ExpressionAttributeNames: map[string]string{
+			"#publisher": store.DefaultAttributeNames.Publisher,
+			"#order":     store.DefaultAttributeNames.Order,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":publisher": &types.AttributeValueMemberS{Value: probe.Publisher},
+			":order":     &types.AttributeValueMemberN{Value: fmt.Sprint(probe.Order)},
+		},
+		Limit: aws.Int32(1),
+	}
+	delay := DefaultPollInterval
+	for {
+		result, err := c.Query(ctx, input)
+		if err != nil {
+			return err
+		}
+		messages, err := ParseQueryResults(result)
+		if err != nil {
+			return err
+		}
+		if len(messages) > 0 && messages[0] == probe.Content {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("probe message %s never reached table %s, found %v", probe.Publisher, table, messages)
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, DefaultMaxPollInterval)
+	}
+}
+
+// TeardownEventBridgeReceiverInfrastructure destroys the infrastructure
+// SetupEventBridgeReceiverInfrastructure applied for the publisher with
+// the same config and options.
+func TeardownEventBridgeReceiverInfrastructure(cfg aws.Config, p *Publisher, infra InfraConfig, opts ...InfrastructureOptions) error {
+	i, err := publisherInfrastructure(cfg, p, infra, opts)
 	if err != nil {
 		return err
 	}
+	_, err = i.Destroy(context.Background())
 	return err
 }
 
-func createLambdaFunction(cfg aws.Config, name string) error {
-	inlinePolicy := glambda.WithInlinePolicy(`{"Version": "2012-10-17","Statement":{"Effect": "Allow","Action": "dynamodb:*","Resource": "*"}}`)
-	executionRole := glambda.WithExecutionRole("rivulet-lambda-role", inlinePolicy)
-	resourcePolicy := glambda.WithResourcePolicy("events.amazonaws.com")
-	l := glambda.NewLambda(name, "cmd/lambda/main.go", executionRole, resourcePolicy, glambda.WithAWSConfig(cfg))
-	return l.Deploy()
+// publisherInfrastructure creates the [Infrastructure] for the publisher,
+// naming the function after it and deploying to the AWS configuration's
+// region unless the config says otherwise.
+func publisherInfrastructure(cfg aws.Config, p *Publisher, infra InfraConfig, opts []InfrastructureOptions) (*Infrastructure, error) {
+	if infra.FunctionName == "" {
+		infra.FunctionName = p.name
+	}
+	if infra.Region == "" {
+		infra.Region = cfg.Region
+	}
+	return NewInfrastructure(infra, append([]InfrastructureOptions{WithInfraAWSConfig(cfg)}, opts...)...)
 }
@@ -0,0 +1,550 @@
+package rivulet_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdaTypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mr-joshcrane/rivulet"
+)
+
+func TestInfrastructure_ApplyCreatesWhatThePlanSaysIsMissing(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	infra := helperInfrastructure(t, fake, rivulet.InfraConfig{EventBusName: "orders", Table: "messages"})
+	plan, err := infra.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rivulet.InfraPlan{
+		{Action: rivulet.InfraCreate, Resource: "table", Name: "messages"},
+		{Action: rivulet.InfraCreate, Resource: "function", Name: "receiver"},
+		{Action: rivulet.InfraCreate, Resource: "rule", Name: "receiver"},
+		{Action: rivulet.InfraCreate, Resource: "target", Name: "arn:aws:lambda:eu-west-1:111122223333:function:receiver"},
+	}
+	if !cmp.Equal(want, plan) {
+		t.Fatal(cmp.Diff(want, plan))
+	}
+	applied, err := infra.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, applied) {
+		t.Error(cmp.Diff(want, applied))
+	}
+	rule := fake.Rules["orders/receiver"]
+	if rule == nil || aws.ToString(rule.EventPattern) != rivulet.DefaultRulePattern {
+		t.Errorf("want rule on bus orders with the default pattern, got %+v", rule)
+	}
+	if !cmp.Equal([]string{"receiver"}, fake.Deployed) {
+		t.Errorf("want function deployed once, got %v", fake.Deployed)
+	}
+	plan, err = infra.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Resource != "function" || plan[0].Action != rivulet.InfraUpdate {
+		t.Errorf("want only the function's code redeployed once applied, got %v", plan)
+	}
+}
+
+func TestInfrastructure_PlanUpdatesARuleThatHasDrifted(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	infra := helperInfrastructure(t, fake, rivulet.InfraConfig{RulePattern: `{"source":["orders"]}`})
+	_, err := infra.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Rules["default/receiver"].EventPattern = aws.String(`{"source":["other"]}`)
+	fake.Targets["default/receiver"] = nil
+	plan, err := infra.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 3 || plan[1].Resource != "rule" || plan[2].Resource != "target" {
+		t.Fatalf("want the rule updated and its target recreated, got %v", plan)
+	}
+	if !strings.Contains(plan[1].Reason, `{"source":["other"]}`) {
+		t.Errorf("want the drifted pattern reported, got %q", plan[1].Reason)
+	}
+	_, err = infra.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.ToString(fake.Rules["default/receiver"].EventPattern); got != `{"source":["orders"]}` {
+		t.Errorf("want the rule's pattern restored, got %s", got)
+	}
+}
+
+func TestInfrastructure_PlanTreatsReformattedPatternsAsUnchanged(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	infra := helperInfrastructure(t, fake, rivulet.InfraConfig{})
+	_, err := infra.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Rules["default/receiver"].EventPattern = aws.String(`{ "detail-type": ["rivulet"], "source": ["rivulet"] }`)
+	plan, err := infra.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 {
+		t.Errorf("want no change to the rule, got %v", plan)
+	}
+}
+
+func TestInfrastructure_DestroyKeepsTheTableUnlessAskedAndCanBeRepeated(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	infra := helperInfrastructure(t, fake, rivulet.InfraConfig{})
+	_, err := infra.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	destroyed, err := infra.Destroy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rivulet.InfraPlan{
+		{Action: rivulet.InfraDelete, Resource: "target", Name: "arn:aws:lambda:eu-west-1:111122223333:function:receiver"},
+		{Action: rivulet.InfraDelete, Resource: "rule", Name: "receiver"},
+		{Action: rivulet.InfraDelete, Resource: "function", Name: "receiver"},
+	}
+	if !cmp.Equal(want, destroyed) {
+		t.Error(cmp.Diff(want, destroyed))
+	}
+	if fake.Tables["rivulet"] == nil {
+		t.Error("want the table kept")
+	}
+	infra = helperInfrastructure(t, fake, rivulet.InfraConfig{DeleteTable: true})
+	destroyed, err = infra.Destroy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = rivulet.InfraPlan{{Action: rivulet.InfraDelete, Resource: "table", Name: "rivulet"}}
+	if !cmp.Equal(want, destroyed) {
+		t.Error(cmp.Diff(want, destroyed))
+	}
+}
+
+func TestInfrastructure_StopsApplyingAtTheFirstFailure(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	fake.DeployErr = errors.New("build failed")
+	infra := helperInfrastructure(t, fake, rivulet.InfraConfig{})
+	applied, err := infra.Apply(context.Background())
+	if !errors.Is(err, fake.DeployErr) {
+		t.Fatalf("want %v, got %v", fake.DeployErr, err)
+	}
+	if len(applied) != 1 || applied[0].Resource != "table" {
+		t.Errorf("want only the table created, got %v", applied)
+	}
+	if len(fake.Rules) != 0 {
+		t.Errorf("want no rule created, got %v", fake.Rules)
+	}
+}
+
+func TestInfrastructure_VerifyReportsNoDriftOnceApplied(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	infra := helperInfrastructure(t, fake, rivulet.InfraConfig{Table: "messages"})
+	_, err := infra.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := infra.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 0 {
+		t.Errorf("want no drift, got %v", report)
+	}
+}
+
+func TestInfrastructure_VerifyReportsEveryDriftedResource(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	infra := helperInfrastructure(t, fake, rivulet.InfraConfig{Table: "messages"})
+	_, err := infra.Apply(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Tables["messages"].TableStatus = ddbTypes.TableStatusDeleting
+	fake.Functions["receiver"].Environment = nil
+	fake.Rules["default/receiver"].State = types.RuleStateDisabled
+	fake.Targets["default/receiver"] = []types.Target{{Id: aws.String("old"), Arn: aws.String("arn:aws:lambda:eu-west-1:111122223333:function:old")}}
+	report, err := infra.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rivulet.DriftReport{
+		{Resource: "table", Name: "messages", Problem: "status is DELETING"},
+		{Resource: "function", Name: "receiver", Problem: "saves to table rivulet, want messages"},
+		{Resource: "rule", Name: "receiver", Problem: "state is DISABLED"},
+		{Resource: "target", Name: "arn:aws:lambda:eu-west-1:111122223333:function:receiver", Problem: "missing"},
+		{Resource: "target", Name: "arn:aws:lambda:eu-west-1:111122223333:function:old", Problem: "not in config"},
+	}
+	if !cmp.Equal(want, report) {
+		t.Error(cmp.Diff(want, report))
+	}
+}
+
+func TestInfrastructure_VerifyReportsEachDriftedFunctionField(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		drift func(*lambdaTypes.FunctionConfiguration)
+		want  string
+	}{
+		"execution role": {
+			func(fn *lambdaTypes.FunctionConfiguration) {
+				fn.Role = aws.String("arn:aws:iam::111122223333:role/admin")
+			},
+			"runs as role arn:aws:iam::111122223333:role/admin, want arn:aws:iam::111122223333:role/rivulet-lambda-role",
+		},
+		"region": {
+			func(fn *lambdaTypes.FunctionConfiguration) {
+				fn.FunctionArn = aws.String("arn:aws:lambda:us-east-1:111122223333:function:receiver")
+			},
+			"is arn:aws:lambda:us-east-1:111122223333:function:receiver, want arn:aws:lambda:eu-west-1:111122223333:function:receiver",
+		},
+		"state": {
+			func(fn *lambdaTypes.FunctionConfiguration) {
+				fn.State = lambdaTypes.StateFailed
+			},
+			"state is Failed",
+		},
+		"table": {
+			func(fn *lambdaTypes.FunctionConfiguration) {
+				fn.Environment.Variables[rivulet.TableEnvironmentVariable] = "other"
+			},
+			"saves to table other, want messages",
+		},
+	}
+	for name, tc := range tests {
+		fake := NewFakeAWS()
+		infra := helperInfrastructure(t, fake, rivulet.InfraConfig{Table: "messages"})
+		_, err := infra.Apply(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.drift(fake.Functions["receiver"])
+		report, err := infra.Verify(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := rivulet.DriftReport{{Resource: "function", Name: "receiver", Problem: tc.want}}
+		if !cmp.Equal(want, report) {
+			t.Errorf("%s: %s", name, cmp.Diff(want, report))
+		}
+	}
+}
+
+func TestInfrastructure_VerifyReportsMissingResources(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	infra := helperInfrastructure(t, fake, rivulet.InfraConfig{})
+	report, err := infra.Verify(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rivulet.DriftReport{
+		{Resource: "table", Name: "rivulet", Problem: "missing"},
+		{Resource: "function", Name: "receiver", Problem: "missing"},
+		{Resource: "rule", Name: "receiver", Problem: "missing"},
+	}
+	if !cmp.Equal(want, report) {
+		t.Error(cmp.Diff(want, report))
+	}
+}
+
+func TestSetupEventBridgeReceiverInfrastructure_ProbesTheTableAndDeletesTheProbe(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	p := rivulet.NewPublisher("orders", rivulet.WithTransport(fake))
+	cfg := rivulet.InfraConfig{Account: "111122223333", Region: "eu-west-1", Table: "messages"}
+	opts := []rivulet.InfrastructureOptions{
+		rivulet.WithInfraClients(fake, fake, fake),
+		rivulet.WithFunctionDeployer(fake),
+	}
+	err := rivulet.SetupEventBridgeReceiverInfrastructure(aws.Config{}, p, cfg, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Published) != 1 || !strings.HasPrefix(fake.Published[0], "orders-probe-") {
+		t.Errorf("want one probe published under a publisher of its own, got %v", fake.Published)
+	}
+	if len(fake.Items["messages"]) != 0 {
+		t.Errorf("want the probe deleted from the table, got %v", fake.Items["messages"])
+	}
+	err = rivulet.TeardownEventBridgeReceiverInfrastructure(aws.Config{}, p, cfg, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Functions) != 0 {
+		t.Errorf("want the function destroyed, got %v", fake.Functions)
+	}
+}
+
+func TestNewInfrastructure_RejectsIncompleteOrInvalidConfig(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeAWS()
+	opts := []rivulet.InfrastructureOptions{
+		rivulet.WithInfraClients(fake, fake, fake),
+		rivulet.WithFunctionDeployer(fake),
+	}
+	for name, cfg := range map[string]rivulet.InfraConfig{
+		"no account":       {Region: "eu-west-1", FunctionName: "receiver"},
+		"no region":        {Account: "111122223333", FunctionName: "receiver"},
+		"no function":      {Account: "111122223333", Region: "eu-west-1"},
+		"invalid pattern":  {Account: "111122223333", Region: "eu-west-1", FunctionName: "receiver", RulePattern: `{"source":"rivulet"}`},
+		"unparsed pattern": {Account: "111122223333", Region: "eu-west-1", FunctionName: "receiver", RulePattern: `source = rivulet`},
+	} {
+		_, err := rivulet.NewInfrastructure(cfg, opts...)
+		if err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func helperInfrastructure(t *testing.T, fake *FakeAWS, cfg rivulet.InfraConfig) *rivulet.Infrastructure {
+	t.Helper()
+	cfg.Account = "111122223333"
+	cfg.Region = "eu-west-1"
+	cfg.FunctionName = "receiver"
+	infra, err := rivulet.NewInfrastructure(cfg, rivulet.WithInfraClients(fake, fake, fake), rivulet.WithFunctionDeployer(fake))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return infra
+}
+
+// FakeAWS keeps the EventBridge rules and targets, Lambda functions and
+// DynamoDB tables managed by an Infrastructure in memory. Rules and
+// targets are keyed by bus and rule name, as "bus/rule", and the items
+// in each table by publisher and order, as "publisher/order".
+//
+// It is also a [rivulet.Transport] standing in for EventBridge and the
+// deployed function, saving each message published to the table named
+// by the environment of the only function deployed.
+type FakeAWS struct {
+	mu        sync.Mutex
+	Rules     map[string]*eventbridge.DescribeRuleOutput
+	Targets   map[string][]types.Target
+	Functions map[string]*lambdaTypes.FunctionConfiguration
+	Tables    map[string]*ddbTypes.TableDescription
+	Items     map[string]map[string]map[string]ddbTypes.AttributeValue
+	Deployed  []string
+	DeployErr error
+	Published []string
+}
+
+func NewFakeAWS() *FakeAWS {
+	return &FakeAWS{
+		Rules:     map[string]*eventbridge.DescribeRuleOutput{},
+		Targets:   map[string][]types.Target{},
+		Functions: map[string]*lambdaTypes.FunctionConfiguration{},
+		Tables:    map[string]*ddbTypes.TableDescription{},
+		Items:     map[string]map[string]map[string]ddbTypes.AttributeValue{},
+	}
+}
+
+func ruleKey(bus, rule *string) string {
+	return aws.ToString(bus) + "/" + aws.ToString(rule)
+}
+
+func (f *FakeAWS) DescribeRule(ctx context.Context, input *eventbridge.DescribeRuleInput, opts ...func(*eventbridge.Options)) (*eventbridge.DescribeRuleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rule, ok := f.Rules[ruleKey(input.EventBusName, input.Name)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("rule not found")}
+	}
+	return rule, nil
+}
+
+func (f *FakeAWS) PutRule(ctx context.Context, input *eventbridge.PutRuleInput, opts ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Rules[ruleKey(input.EventBusName, input.Name)] = &eventbridge.DescribeRuleOutput{
+		Name:         input.Name,
+		EventBusName: input.EventBusName,
+		EventPattern: input.EventPattern,
+		State:        input.State,
+		RoleArn:      input.RoleArn,
+	}
+	return &eventbridge.PutRuleOutput{}, nil
+}
+
+func (f *FakeAWS) DeleteRule(ctx context.Context, input *eventbridge.DeleteRuleInput, opts ...func(*eventbridge.Options)) (*eventbridge.DeleteRuleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := ruleKey(input.EventBusName, input.Name)
+	if _, ok := f.Rules[key]; !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("rule not found")}
+	}
+	delete(f.Rules, key)
+	return &eventbridge.DeleteRuleOutput{}, nil
+}
+
+func (f *FakeAWS) ListTargetsByRule(ctx context.Context, input *eventbridge.ListTargetsByRuleInput, opts ...func(*eventbridge.Options)) (*eventbridge.ListTargetsByRuleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := ruleKey(input.EventBusName, input.Rule)
+	if _, ok := f.Rules[key]; !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("rule not found")}
+	}
+	return &eventbridge.ListTargetsByRuleOutput{Targets: f.Targets[key]}, nil
+}
+
+func (f *FakeAWS) PutTargets(ctx context.Context, input *eventbridge.PutTargetsInput, opts ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := ruleKey(input.EventBusName, input.Rule)
+	f.Targets[key] = append(f.Targets[key], input.Targets...)
+	return &eventbridge.PutTargetsOutput{}, nil
+}
+
+func (f *FakeAWS) RemoveTargets(ctx context.Context, input *eventbridge.RemoveTargetsInput, opts ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := ruleKey(input.EventBusName, input.Rule)
+	var kept []types.Target
+	for _, t := range f.Targets[key] {
+		removed := false
+		for _, id := range input.Ids {
+			removed = removed || aws.ToString(t.Id) == id
+		}
+		if !removed {
+			kept = append(kept, t)
+		}
+	}
+	f.Targets[key] = kept
+	return &eventbridge.RemoveTargetsOutput{}, nil
+}
+
+func (f *FakeAWS) GetFunction(ctx context.Context, input *lambda.GetFunctionInput, opts ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn, ok := f.Functions[aws.ToString(input.FunctionName)]
+	if !ok {
+		return nil, &lambdaTypes.ResourceNotFoundException{Message: aws.String("function not found")}
+	}
+	return &lambda.GetFunctionOutput{Configuration: fn}, nil
+}
+
+func (f *FakeAWS) DeleteFunction(ctx context.Context, input *lambda.DeleteFunctionInput, opts ...func(*lambda.Options)) (*lambda.DeleteFunctionOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.Functions[aws.ToString(input.FunctionName)]; !ok {
+		return nil, &lambdaTypes.ResourceNotFoundException{Message: aws.String("function not found")}
+	}
+	delete(f.Functions, aws.ToString(input.FunctionName))
+	return &lambda.DeleteFunctionOutput{}, nil
+}
+
+func (f *FakeAWS) Deploy(ctx context.Context, cfg rivulet.InfraConfig) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.DeployErr != nil {
+		return f.DeployErr
+	}
+	f.Functions[cfg.FunctionName] = &lambdaTypes.FunctionConfiguration{
+		FunctionName: aws.String(cfg.FunctionName),
+		FunctionArn:  aws.String(cfg.FunctionARN()),
+		Role:         aws.String(fmt.Sprintf("arn:aws:iam::%s:role/%s", cfg.Account, cfg.ExecutionRole)),
+		State:        lambdaTypes.StateActive,
+		Environment: &lambdaTypes.EnvironmentResponse{
+			Variables: map[string]string{rivulet.TableEnvironmentVariable: cfg.Table},
+		},
+	}
+	f.Deployed = append(f.Deployed, cfg.FunctionName)
+	return nil
+}
+
+func (f *FakeAWS) DescribeTable(ctx context.Context, input *dynamodb.DescribeTableInput, opts ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table, ok := f.Tables[aws.ToString(input.TableName)]
+	if !ok {
+		return nil, &ddbTypes.ResourceNotFoundException{Message: aws.String("table not found")}
+	}
+	return &dynamodb.DescribeTableOutput{Table: table}, nil
+}
+
+func (f *FakeAWS) CreateTable(ctx context.Context, input *dynamodb.CreateTableInput, opts ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Tables[aws.ToString(input.TableName)] = &ddbTypes.TableDescription{
+		TableName:   input.TableName,
+		TableStatus: ddbTypes.TableStatusActive,
+		KeySchema:   input.KeySchema,
+	}
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (f *FakeAWS) DeleteTable(ctx context.Context, input *dynamodb.DeleteTableInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.Tables[aws.ToString(input.TableName)]; !ok {
+		return nil, &ddbTypes.ResourceNotFoundException{Message: aws.String("table not found")}
+	}
+	delete(f.Tables, aws.ToString(input.TableName))
+	return &dynamodb.DeleteTableOutput{}, nil
+}
+
+func (f *FakeAWS) Query(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	publisher := input.ExpressionAttributeValues[":publisher"].(*ddbTypes.AttributeValueMemberS).Value
+	order := input.ExpressionAttributeValues[":order"].(*ddbTypes.AttributeValueMemberN).Value
+	out := &dynamodb.QueryOutput{}
+	if item, ok := f.Items[aws.ToString(input.TableName)][publisher+"/"+order]; ok {
+		out.Items = append(out.Items, item)
+	}
+	return out, nil
+}
+
+func (f *FakeAWS) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	publisher := input.Key["Publisher"].(*ddbTypes.AttributeValueMemberS).Value
+	order := input.Key["Order"].(*ddbTypes.AttributeValueMemberN).Value
+	delete(f.Items[aws.ToString(input.TableName)], publisher+"/"+order)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *FakeAWS) Publish(m rivulet.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.Functions) != 1 {
+		return fmt.Errorf("want one function deployed to receive messages, got %d", len(f.Functions))
+	}
+	var table string
+	for _, fn := range f.Functions {
+		table = fn.Environment.Variables[rivulet.TableEnvironmentVariable]
+	}
+	if f.Items[table] == nil {
+		f.Items[table] = map[string]map[string]ddbTypes.AttributeValue{}
+	}
+	order := fmt.Sprint(m.Order)
+	f.Items[table][m.Publisher+"/"+order] = map[string]ddbTypes.AttributeValue{
+		"Publisher": &ddbTypes.AttributeValueMemberS{Value: m.Publisher},
+		"Order":     &ddbTypes.AttributeValueMemberN{Value: order},
+		"Content":   &ddbTypes.AttributeValueMemberS{Value: m.Content},
+	}
+	f.Published = append(f.Published, m.Publisher)
+	return nil
+}
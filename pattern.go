@@ -0,0 +1,325 @@
+package rivulet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultRulePattern is the event pattern of the EventBridge Rule routing
+// events sent by an [EventBridgeTransport] with its default options.
+const DefaultRulePattern = `{"source":["rivulet"],"detail-type":["rivulet"]}`
+
+// Pattern is a parsed EventBridge event pattern. Each field of a pattern
+// names a field of the event, and holds either a nested pattern for an
+// object field, or an array of the conditions the field may satisfy.
+//
+// Conditions are exact values (strings, numbers, booleans or null), or
+// objects using one of the EventBridge content filters:
+//
+//	{"prefix": "eu-"}
+//	{"suffix": ".png"}
+//	{"equals-ignore-case": "Rivulet"}
+//	{"anything-but": "rivulet"}, {"anything-but": [1, 2]} or {"anything-but": {"prefix": "test-"}}
+//	{"numeric": [">", 0, "<=", 5]}
+//	{"exists": true}
+//
+// A field matches if it satisfies any of its conditions, and an event
+// matches if every field of the pattern does. A field of the event holding
+// an array matches if any of its elements does.
+type Pattern struct {
+	fields map[string]field
+}
+
+// field is either a nested pattern, or the conditions on a value.
+type field struct {
+	nested     *Pattern
+	conditions []condition
+}
+
+// condition reports whether a value satisfies it. present is false, and
+// value nil, when the event doesn't have the field at all.
+type condition func(value any, present bool) bool
+
+// ParsePattern parses an EventBridge event pattern from JSON, reporting
+// any syntax EventBridge would reject.
+func ParsePattern(pattern string) (*Pattern, error) {
+	var fields map[string]any
+	err := json.Unmarshal([]byte(pattern), &fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event pattern: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("invalid event pattern: no fields")
+	}
+	p, err := parseFields(fields, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid event pattern: %w", err)
+	}
+	return p, nil
+}
+
+func parseFields(fields map[string]any, path string) (*Pattern, error) {
+	p := &Pattern{fields: map[string]field{}}
+	// Parse in a fixed order, so the same pattern always reports the same error.
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch v := fields[name].(type) {
+		case map[string]any:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%s%s has no fields", path, name)
+			}
+			nested, err := parseFields(v, path+name+".")
+			if err != nil {
+				return nil, err
+			}
+			p.fields[name] = field{nested: nested}
+		case []any:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%s%s has no values to match", path, name)
+			}
+			var conditions []condition
+			for _, value := range v {
+				c, err := parseCondition(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s%s: %w", path, name, err)
+				}
+				conditions = append(conditions, c)
+			}
+			p.fields[name] = field{conditions: conditions}
+		default:
+			return nil, fmt.Errorf("%s%s must be an object or an array", path, name)
+		}
+	}
+	return p, nil
+}
+
+func parseCondition(value any) (condition, error) {
+	switch v := value.(type) {
+	case []any:
+		return nil, errors.New("arrays can't be matched")
+	case map[string]any:
+		if len(v) != 1 {
+			return nil, fmt.Errorf("a content filter must have exactly one operator, got %d", len(v))
+		}
+		for op, operand := range v {
+			return parseFilter(op, operand)
+		}
+	}
+	return present(func(got any) bool { return got == value }), nil
+}
+
+// parseFilter parses a content filter, such as {"prefix": "eu-"}.
+func parseFilter(op string, operand any) (condition, error) {
+	switch op {
+	case "prefix", "suffix", "equals-ignore-case":
+		match, err := parseStringFilter(op, operand)
+		if err != nil {
+			return nil, err
+		}
+		return present(match), nil
+	case "anything-but":
+		return parseAnythingBut(operand)
+	case "numeric":
+		return parseNumeric(operand)
+	case "exists":
+		want, ok := operand.(bool)
+		if !ok {
+			return nil, errors.New("exists must be true or false")
+		}
+		return func(value any, present bool) bool {
+			_, isObject := value.(map[string]any)
+			return (present && !isObject) == want
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown content filter %q", op)
+}
+
+func parseStringFilter(op string, operand any) (func(any) bool, error) {
+	s, ok := operand.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a string", op)
+	}
+	var match func(string) bool
+	switch op {
+	case "prefix":
+		match = func(got string) bool { return strings.HasPrefix(got, s) }
+	case "suffix":
+		match = func(got string) bool { return strings.HasSuffix(got, s) }
+	case "equals-ignore-case":
+		match = func(got string) bool { return strings.EqualFold(got, s) }
+	}
+	return func(value any) bool {
+		got, ok := value.(string)
+		return ok && match(got)
+	}, nil
+}
+
+// parseAnythingBut parses the operand of an anything-but filter: a value,
+// an array of values, or a prefix or suffix filter.
+func parseAnythingBut(operand any) (condition, error) {
+	var excluded func(any) bool
+	switch v := operand.(type) {
+	case []any:
+		if len(v) == 0 {
+			return nil, errors.New("anything-but has no values")
+		}
+		for _, value := range v {
+			switch value.(type) {
+			case string, float64:
+			default:
+				return nil, errors.New("anything-but can only exclude strings and numbers")
+			}
+		}
+		excluded = func(got any) bool {
+			for _, value := range v {
+				if got == value {
+					return true
+				}
+			}
+			return false
+		}
+	case map[string]any:
+		if len(v) != 1 {
+			return nil, errors.New("anything-but takes a single prefix or suffix filter")
+		}
+		for op, operand := range v {
+			if op != "prefix" && op != "suffix" {
+				return nil, fmt.Errorf("anything-but can't be combined with %q", op)
+			}
+			match, err := parseStringFilter(op, operand)
+			if err != nil {
+				return nil, err
+			}
+			excluded = match
+		}
+	case string, float64:
+		excluded = func(got any) bool { return got == v }
+	default:
+		return nil, errors.New("anything-but can only exclude strings and numbers")
+	}
+	return present(func(value any) bool { return !excluded(value) }), nil
+}
+
+// parseNumeric parses the operand of a numeric filter, an array of
+// comparison operators each followed by a number.
+func parseNumeric(operand any) (condition, error) {
+	terms, ok := operand.([]any)
+	if !ok || len(terms) == 0 || len(terms)%2 != 0 {
+		return nil, errors.New("numeric takes pairs of an operator and a number")
+	}
+	var comparisons []func(float64) bool
+	for i := 0; i < len(terms); i += 2 {
+		op, ok := terms[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("numeric operator %v is not a string", terms[i])
+		}
+		n, ok := terms[i+1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("numeric operand %v is not a number", terms[i+1])
+		}
+		switch op {
+		case "<":
+			comparisons = append(comparisons, func(got float64) bool { return got < n })
+		case "<=":
+			comparisons = append(comparisons, func(got float64) bool { return got <= n })
+		case "=":
+			comparisons = append(comparisons, func(got float64) bool { return got == n })
+		case ">=":
+			comparisons = append(comparisons, func(got float64) bool { return got >= n })
+		case ">":
+			comparisons = append(comparisons, func(got float64) bool { return got > n })
+		default:
+			return nil, fmt.Errorf("unknown numeric operator %q", op)
+		}
+	}
+	return present(func(value any) bool {
+		got, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		for _, compare := range comparisons {
+			if !compare(got) {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// present makes a condition only fields the event has can satisfy.
+func present(match func(any) bool) condition {
+	return func(value any, present bool) bool {
+		return present && match(value)
+	}
+}
+
+// Match reports whether the event, as JSON, matches the pattern.
+func (p *Pattern) Match(event []byte) (bool, error) {
+	var fields map[string]any
+	err := json.Unmarshal(event, &fields)
+	if err != nil {
+		return false, fmt.Errorf("invalid event: %w", err)
+	}
+	return p.match(fields), nil
+}
+
+// MatchMessage reports whether the event an [EventBridgeTransport] with its
+// default options would send for the message matches the pattern.
+func (p *Pattern) MatchMessage(m Message) (bool, error) {
+	detail, err := DefaultTransform(m)
+	if err != nil {
+		return false, err
+	}
+	event, err := json.Marshal(map[string]any{
+		"source":      "rivulet",
+		"detail-type": "rivulet",
+		"detail":      json.RawMessage(detail),
+	})
+	if err != nil {
+		return false, err
+	}
+	return p.Match(event)
+}
+
+func (p *Pattern) match(event map[string]any) bool {
+	for name, f := range p.fields {
+		got, ok := event[name]
+		if f.nested != nil {
+			// A missing object has none of the fields the nested pattern
+			// names, which {"exists": false} is still satisfied by.
+			object, _ := got.(map[string]any)
+			if !f.nested.match(object) {
+				return false
+			}
+			continue
+		}
+		if !f.matchValue(got, ok) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValue reports whether the event value, or any element of it if it
+// is an array, satisfies one of the field's conditions.
+func (f field) matchValue(got any, present bool) bool {
+	values, isArray := got.([]any)
+	if !isArray || len(values) == 0 {
+		values = []any{got}
+	}
+	for _, v := range values {
+		for _, c := range f.conditions {
+			if c(v, present) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,66 +2,305 @@ package rivulet
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"sort"
 	"strconv"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mr-joshcrane/rivulet/store"
 )
 
+// Reader reads a publisher's stream from a [store.Store] incrementally,
+// returning only messages it hasn't returned before. With a [Cursor] it
+// checkpoints its position, so that a reader restarted after a crash
+// resumes exactly after the last Order it committed.
+//
+// Transports may deliver messages out of order, so a Reader only ever
+// releases a contiguous sequence of orders. Messages stored beyond a gap
+// are held in a reorder buffer until the gap is filled, or until the buffer
+// outgrows its window or the gap outlives its timeout, at which point the
+// Reader gives up on the missing orders and moves past them.
 type Reader struct {
 	PublisherName  string
 	CurrentMessage int
-	Store          MessageStore
+	Store          store.Store
+
+	cursor    Cursor
+	cursorKey string
+	resumed   bool
+
+	pending  map[int]Message
+	window   int
+	timeout  time.Duration
+	gapSince time.Time
+	onGap    func(Gap)
+	now      func() time.Time
+
+	pollMin time.Duration
+	pollMax time.Duration
+}
+
+// Gap is a range of orders, From and To inclusive, missing from a publisher's stream.
+type Gap struct {
+	From int
+	To   int
+}
+
+const (
+	// DefaultReorderWindow is how many messages a [Reader] holds behind a gap by default.
+	DefaultReorderWindow = 1_000
+	// DefaultReorderTimeout is how long a [Reader] waits for a gap to fill by default.
+	DefaultReorderTimeout = time.Minute
+)
+
+// ReaderOptions are functional options for configuring a [Reader].
+type ReaderOptions func(*Reader)
+
+// WithStore is a functional option specifying the [store.Store] a [Reader] reads from.
+func WithStore(s store.Store) ReaderOptions {
+	return func(r *Reader) {
+		r.Store = s
+	}
 }
 
-type MessageStore interface {
-	All() []Message
+// WithCursor is a functional option specifying the [Cursor] a [Reader]
+// resumes from and commits its position to, under the given key.
+// Readers sharing a Cursor need distinct keys.
+func WithCursor(c Cursor, key string) ReaderOptions {
+	return func(r *Reader) {
+		r.cursor = c
+		r.cursorKey = key
+	}
+}
+
+// WithReorderWindow is a functional option specifying how long a [Reader]
+// waits for a gap in the stream to be filled. It gives up on the gap once more
+// than size messages are buffered behind it, or once it has waited for timeout.
+// A zero size or timeout selects [DefaultReorderWindow] or [DefaultReorderTimeout].
+func WithReorderWindow(size int, timeout time.Duration) ReaderOptions {
+	return func(r *Reader) {
+		r.window = size
+		r.timeout = timeout
+	}
+}
+
+// WithGapHandler is a functional option specifying a function a [Reader]
+// calls with each [Gap] it gives up waiting for and skips.
+func WithGapHandler(f func(Gap)) ReaderOptions {
+	return func(r *Reader) {
+		r.onGap = f
+	}
+}
+
+// WithReaderClock is a functional option specifying where a [Reader] gets
+// the current time from when timing gaps. It defaults to [time.Now].
+func WithReaderClock(clock func() time.Time) ReaderOptions {
+	return func(r *Reader) {
+		r.now = clock
+	}
 }
 
-func NewReader(publsherName string) *Reader {
-	return &Reader{
+func NewReader(publsherName string, opts ...ReaderOptions) *Reader {
+	r := &Reader{
 		PublisherName:  publsherName,
 		CurrentMessage: 0,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.applyDefaults()
+	return r
 }
 
-func (r *Reader) NewMessages() []string {
-	messages := r.Store.All()
-	var newMessages []string
-	for _, msg := range messages {
+// applyDefaults fills in any settings left unset, so that a Reader built
+// as a struct literal rather than by [NewReader] works too.
+func (r *Reader) applyDefaults() {
+	if r.pending == nil {
+		r.pending = map[int]Message{}
+	}
+	if r.window == 0 {
+		r.window = DefaultReorderWindow
+	}
+	if r.timeout == 0 {
+		r.timeout = DefaultReorderTimeout
+	}
+	if r.now == nil {
+		r.now = time.Now
+	}
+	if r.pollMin == 0 {
+		r.pollMin = DefaultPollInterval
+	}
+	if r.pollMax == 0 {
+		r.pollMax = DefaultMaxPollInterval
+	}
+}
+
+// Next returns the messages stored since the last call, in order and without
+// gaps, holding back any that arrived ahead of a missing order. A Reader
+// at the beginning of the stream starts from the lowest order stored, so a
+// stream whose start has been evicted or filtered out has no leading gap.
+// On its first call a Reader with a [Cursor] resumes from the last
+// committed position. Next does not commit; call Commit once the
+// messages have been processed.
+func (r *Reader) Next(ctx context.Context) ([]Message, error) {
+	if r.Store == nil {
+		return nil, fmt.Errorf("reader for %s has no store", r.PublisherName)
+	}
+	r.applyDefaults()
+	err := r.resume(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := r.Store.Range(ctx, r.PublisherName, store.After(r.CurrentMessage))
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range stored {
 		if msg.Order > r.CurrentMessage {
-			newMessages = append(newMessages, msg.Content)
+			r.pending[msg.Order] = FromStoreMessage(msg)
 		}
-		r.CurrentMessage = msg.Order
 	}
-	return newMessages
+	if r.CurrentMessage == 0 && len(r.pending) > 0 {
+		// Retention or a filter may have removed the start of the stream,
+		// so a Reader at the beginning starts from the lowest order stored.
+		r.CurrentMessage = r.pendingOrders()[0] - 1
+	}
+	return r.release(), nil
 }
 
-func Read(ctx context.Context, publisherName string) ([]string, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+// release returns the contiguous run of buffered messages following the
+// current position, skipping a gap if it has been waited on for too long.
+func (r *Reader) release() []Message {
+	var messages []Message
+	for len(r.pending) > 0 {
+		next := r.CurrentMessage + 1
+		if msg, ok := r.pending[next]; ok {
+			messages = append(messages, msg)
+			delete(r.pending, next)
+			r.CurrentMessage = next
+			r.gapSince = time.Time{}
+			continue
+		}
+		now := r.now()
+		if r.gapSince.IsZero() {
+			r.gapSince = now
+		}
+		if len(r.pending) <= r.window && now.Sub(r.gapSince) < r.timeout {
+			break
+		}
+		lowest := r.pendingOrders()[0]
+		if r.onGap != nil {
+			r.onGap(Gap{From: next, To: lowest - 1})
+		}
+		r.CurrentMessage = lowest - 1
+		r.gapSince = time.Time{}
+	}
+	if len(r.pending) == 0 {
+		r.gapSince = time.Time{}
+	}
+	return messages
+}
+
+// Gaps returns the ranges of orders the Reader is currently waiting for,
+// each of which has messages buffered behind it.
+func (r *Reader) Gaps() []Gap {
+	var gaps []Gap
+	expected := r.CurrentMessage + 1
+	for _, order := range r.pendingOrders() {
+		if order > expected {
+			gaps = append(gaps, Gap{From: expected, To: order - 1})
+		}
+		expected = order + 1
+	}
+	return gaps
+}
+
+// pendingOrders returns the orders in the reorder buffer, lowest first.
+func (r *Reader) pendingOrders() []int {
+	orders := make([]int, 0, len(r.pending))
+	for order := range r.pending {
+		orders = append(orders, order)
+	}
+	slices.Sort(orders)
+	return orders
+}
+
+// NewMessages returns the contents of the messages stored since the last call.
+func (r *Reader) NewMessages(ctx context.Context) ([]string, error) {
+	messages, err := r.Next(ctx)
 	if err != nil {
 		return nil, err
 	}
-	client := dynamodb.NewFromConfig(cfg)
-	query := Query(publisherName)
-	results, err := client.Query(ctx, query)
+	var contents []string
+	for _, msg := range messages {
+		contents = append(contents, msg.Content)
+	}
+	return contents, nil
+}
+
+// Commit checkpoints the Reader's position to its [Cursor], marking every
+// message returned so far as processed. It does nothing without a Cursor.
+func (r *Reader) Commit(ctx context.Context) error {
+	if r.cursor == nil {
+		return nil
+	}
+	return r.cursor.Save(ctx, r.cursorKey, r.CurrentMessage)
+}
+
+// resume loads the Reader's position from its [Cursor] the first time it is needed.
+func (r *Reader) resume(ctx context.Context) error {
+	if r.resumed || r.cursor == nil {
+		return nil
+	}
+	order, err := r.cursor.Load(ctx, r.cursorKey)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("loading cursor %s: %w", r.cursorKey, err)
 	}
-	return ParseQueryResults(results)
+	r.CurrentMessage = max(r.CurrentMessage, order)
+	r.resumed = true
+	return nil
+}
+
+// Read returns the contents of every message the publisher has published,
+// in order, following pagination so that large streams are read in full.
+// By default messages are read from the "rivulet" table using the default
+// AWS configuration; pass [store.DynamoDBStoreOptions] to read elsewhere.
+func Read(ctx context.Context, publisherName string, opts ...store.DynamoDBStoreOptions) ([]string, error) {
+	return ReadRange(ctx, publisherName, store.Range{}, opts...)
 }
 
-func Query(publisherName string) *dynamodb.QueryInput {
-	return &dynamodb.QueryInput{
-		TableName:              aws.String("rivulet"),
-		KeyConditionExpression: aws.String("Publisher = :publisher"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":publisher": &types.AttributeValueMemberS{Value: publisherName},
-		},
+// ReadRange returns the contents of the publisher's messages selected by the [store.Range].
+func ReadRange(ctx context.Context, publisherName string, r store.Range, opts ...store.DynamoDBStoreOptions) ([]string, error) {
+	s, err := store.NewDynamoDBStore(opts...)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.Range(ctx, publisherName, r)
+	if err != nil {
+		return nil, err
+	}
+	var contents []string
+	for _, msg := range messages {
+		contents = append(contents, msg.Content)
 	}
+	return contents, nil
+}
+
+// Query builds the query for every message the publisher has published.
+// By default it reads the "rivulet" table with the default attribute names;
+// pass [store.WithTable] and [store.WithAttributeNames] to query elsewhere.
+func Query(publisherName string, opts ...store.DynamoDBStoreOptions) *dynamodb.QueryInput {
+	return RangeQuery(publisherName, store.Range{}, opts...)
+}
+
+// RangeQuery builds the query for the publisher's messages selected by the
+// [store.Range], from the table and with the attribute names the options
+// give, as [Query] does.
+func RangeQuery(publisherName string, r store.Range, opts ...store.DynamoDBStoreOptions) *dynamodb.QueryInput {
+	return store.QueryInput(publisherName, r, opts...)
 }
 
 func ParseQueryResults(query *dynamodb.QueryOutput) ([]string, error) {
@@ -1,8 +1,13 @@
 package rivulet
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/mr-joshcrane/rivulet/store"
 )
 
@@ -12,39 +17,96 @@ type Publisher struct {
 	name      string
 	Transport Transport
 	counter   atomic.Int64
+	sequence  SequenceSource
+	ordered   bool
+	handoff   sync.Mutex
+	headers   map[string]string
+	clock     func() time.Time
+	newID     func() string
 }
 
 // Message is a unit of data that can be published by a [Publisher].
 // Message contains the name of the [Publisher] that published it,
 // the order in which it was published, and the content of the message.
+// A Publisher also stamps each Message with a unique ID, the time it was
+// published, and any Headers the caller attached for routing or filtering.
 type Message struct {
 	Publisher string
 	Order     int
 	Content   string
+	ID        string
+	Timestamp time.Time
+	Headers   map[string]string `json:",omitempty"`
 }
 
 // PublisherOptions are functional options for configuring a [Publisher].
-// Pass them to [NewMemoryPublisher] at construction time.
+// Pass them to [NewPublisher] or [NewMemoryPublisher] at construction time.
 type PublisherOptions func(*Publisher)
 
-// NewMemoryPublisher creates a new [Publisher] with the given name and options.
-// By default, the [Publisher] uses an in-memory [Transport].
-func NewMemoryPublisher(name string, options ...PublisherOptions) (*Publisher, *Subscriber) {
-	memoryTransport := NewMemoryTransport()
-	subscriber := &Subscriber{
-		receiver: memoryTransport.GetReceiver(),
-		Store:    store.NewMemoryStore(),
+// WithOrderedDelivery is a functional option specifying that a [Publisher] must hand
+// messages to its [Transport] in Order sequence, even when Publish is called from
+// many goroutines at once. Order assignment and hand-off happen under one lock,
+// so concurrent callers wait for each other's transport calls to return.
+// Without it each message still gets a unique Order, but concurrent callers
+// may reach the Transport in any order.
+func WithOrderedDelivery() PublisherOptions {
+	return func(p *Publisher) {
+		p.ordered = true
+	}
+}
+
+// WithHeaders is a functional option specifying headers that a [Publisher]
+// attaches to every message it publishes.
+func WithHeaders(headers map[string]string) PublisherOptions {
+	return func(p *Publisher) {
+		p.headers = headers
 	}
+}
+
+// WithClock is a functional option specifying where a [Publisher] gets
+// the Timestamp of each message from. It defaults to [time.Now].
+func WithClock(clock func() time.Time) PublisherOptions {
+	return func(p *Publisher) {
+		p.clock = clock
+	}
+}
+
+// WithIDGenerator is a functional option specifying how a [Publisher] generates
+// the ID of each message. It defaults to a random UUID.
+func WithIDGenerator(newID func() string) PublisherOptions {
+	return func(p *Publisher) {
+		p.newID = newID
+	}
+}
+
+// NewPublisher creates a new [Publisher] with the given name and options.
+// By default, the [Publisher] uses an in-memory [Transport], so pass an option
+// such as [WithEventBridgeTransport] to deliver messages anywhere useful.
+func NewPublisher(name string, options ...PublisherOptions) *Publisher {
 	publisher := &Publisher{
 		name:      name,
 		counter:   atomic.Int64{},
-		Transport: memoryTransport,
+		sequence:  NewMemorySequence(),
+		Transport: NewMemoryTransport(),
+		clock:     time.Now,
+		newID:     uuid.NewString,
 	}
 	for _, option := range options {
 		option(publisher)
 	}
+	return publisher
+}
 
-	return publisher, subscriber
+// NewMemoryPublisher creates a new [Publisher] with the given name and options.
+// By default, the [Publisher] uses an in-memory [Transport].
+func NewMemoryPublisher(name string, options ...PublisherOptions) (*Publisher, *Subscriber) {
+	memoryTransport := NewMemoryTransport()
+	subscriber := &Subscriber{
+		receiver: memoryTransport.GetReceiver(),
+		Store:    store.NewMemoryStore(),
+	}
+	options = append([]PublisherOptions{WithTransport(memoryTransport)}, options...)
+	return NewPublisher(name, options...), subscriber
 }
 
 func NewEventBridgePublisher(name string, eventBridge EventBridgeClient, opts ...EventBridgeTransportOptions) *Publisher {
@@ -58,29 +120,178 @@ func NewEventBridgePublisher(name string, eventBridge EventBridgeClient, opts ..
 	for _, opts := range opts {
 		opts(eventBridgeTransport)
 	}
-	publisher := &Publisher{
-		name:      name,
-		counter:   atomic.Int64{},
-		Transport: eventBridgeTransport,
-	}
-
-	return publisher
+	return NewPublisher(name, WithTransport(eventBridgeTransport))
 }
 
 // Counter allows a way for ordering in case transports
 // are not guaranteed to deliver in order.
+// It reports the highest order this Publisher has assigned.
 func (p *Publisher) Counter() int64 {
 	return p.counter.Load()
 }
 
+// reserve takes n consecutive orders from the [SequenceSource]
+// and returns the last of them.
+func (p *Publisher) reserve(ctx context.Context, n int) (int, error) {
+	last, err := p.sequence.Next(ctx, p.name, n)
+	if err != nil {
+		return 0, fmt.Errorf("reserving order: %w", err)
+	}
+	for {
+		current := p.counter.Load()
+		if int64(last) <= current || p.counter.CompareAndSwap(current, int64(last)) {
+			return last, nil
+		}
+	}
+}
+
 // Publish sends a message via a [Transport].
 // A Publisher is responsible for various metadata about the message.
 func (p *Publisher) Publish(str string) error {
-	p.counter.Add(1)
+	return p.PublishContext(context.Background(), str)
+}
+
+// PublishContext sends a message via a [Transport], giving up once the context is done.
+// Transports that implement [ContextTransport] are handed the context so that
+// in-flight deliveries are cancelled too. No order is assigned if the context
+// is already done.
+func (p *Publisher) PublishContext(ctx context.Context, str string) error {
+	return p.PublishWithHeaders(ctx, str, nil)
+}
+
+// PublishWithHeaders behaves like PublishContext, attaching the given headers
+// to the message on top of any the [Publisher] was configured with.
+// Where both set the same header, the value given here wins.
+func (p *Publisher) PublishWithHeaders(ctx context.Context, str string, headers map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.ordered {
+		p.handoff.Lock()
+		defer p.handoff.Unlock()
+	}
+	order, err := p.reserve(ctx, 1)
+	if err != nil {
+		return err
+	}
+	m := p.message(order, str, headers)
+	return p.publish(ctx, m)
+}
+
+// message stamps content with the metadata the Publisher is responsible for.
+func (p *Publisher) message(order int, content string, headers map[string]string) Message {
 	m := Message{
 		Publisher: p.name,
-		Order:     int(p.counter.Load()),
-		Content:   str,
+		Order:     order,
+		Content:   content,
+		ID:        p.newID(),
+		Timestamp: p.clock(),
+	}
+	if len(p.headers)+len(headers) > 0 {
+		m.Headers = make(map[string]string, len(p.headers)+len(headers))
+		for k, v := range p.headers {
+			m.Headers[k] = v
+		}
+		for k, v := range headers {
+			m.Headers[k] = v
+		}
+	}
+	return m
+}
+
+// publish hands a message to the [Transport], passing the context along if it
+// can use it. Transports that can't are only called while the context is live.
+func (p *Publisher) publish(ctx context.Context, m Message) error {
+	if ct, ok := p.Transport.(ContextTransport); ok {
+		return ct.PublishContext(ctx, m)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 	return p.Transport.Publish(m)
 }
+
+// PublishResult is the outcome of publishing a single entry of a batch.
+// Err is nil if the message was handed to the [Transport] successfully.
+type PublishResult struct {
+	Message Message
+	Err     error
+}
+
+// PublishBatch sends many messages via a [Transport], assigning them consecutive
+// orders in the sequence given. If the Transport is a [BatchTransport] the
+// messages are sent together, otherwise they are published one at a time.
+// One result is returned per message, and the error is non-nil if any
+// message failed to publish.
+func (p *Publisher) PublishBatch(contents []string) ([]PublishResult, error) {
+	return p.PublishBatchContext(context.Background(), contents)
+}
+
+// PublishBatchContext behaves like PublishBatch, giving up on any messages
+// not yet delivered once the context is done.
+func (p *Publisher) PublishBatchContext(ctx context.Context, contents []string) ([]PublishResult, error) {
+	if len(contents) == 0 {
+		return nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if p.ordered {
+		p.handoff.Lock()
+		defer p.handoff.Unlock()
+	}
+	last, err := p.reserve(ctx, len(contents))
+	if err != nil {
+		return nil, err
+	}
+	first := last - len(contents) + 1
+	messages := make([]Message, len(contents))
+	for i, content := range contents {
+		messages[i] = p.message(first+i, content, nil)
+	}
+	var errs []error
+	if bt, ok := p.Transport.(BatchTransport); ok {
+		errs = bt.PublishBatch(ctx, messages)
+	} else {
+		errs = make([]error, len(messages))
+		for i, m := range messages {
+			errs[i] = p.publish(ctx, m)
+		}
+	}
+	results := make([]PublishResult, len(messages))
+	failed := 0
+	for i, m := range messages {
+		results[i] = PublishResult{Message: m, Err: errs[i]}
+		if errs[i] != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("failed to publish %d of %d messages", failed, len(messages))
+	}
+	return results, nil
+}
+
+// toStoreMessage converts a Message into the form persisted by a [store.Store].
+func toStoreMessage(m Message) store.Message {
+	return store.Message{
+		Publisher: m.Publisher,
+		Order:     m.Order,
+		Content:   m.Content,
+		ID:        m.ID,
+		Timestamp: m.Timestamp,
+		Headers:   m.Headers,
+	}
+}
+
+// FromStoreMessage converts a message read from a [store.Store] back into a Message.
+func FromStoreMessage(m store.Message) Message {
+	return Message{
+		Publisher: m.Publisher,
+		Order:     m.Order,
+		Content:   m.Content,
+		ID:        m.ID,
+		Timestamp: m.Timestamp,
+		Headers:   m.Headers,
+	}
+}
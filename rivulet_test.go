@@ -3,13 +3,20 @@ package rivulet_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -19,42 +26,356 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/mr-joshcrane/rivulet"
+	"github.com/mr-joshcrane/rivulet/store"
 )
 
-type FakeMessageStore struct {
-	Messages []rivulet.Message
-}
-
-func (f FakeMessageStore) All() []rivulet.Message {
-	return f.Messages
-}
 func TestReader_NewMessages(t *testing.T) {
 	t.Parallel()
-	r := rivulet.NewReader("TestPublisherName")
-	r.Store = FakeMessageStore{
-		Messages: []rivulet.Message{
-			{Publisher: "TestPublisherName", Order: 1, Content: "first message"},
-		},
+	s := store.NewMemoryStore()
+	r := rivulet.NewReader("TestPublisherName", rivulet.WithStore(s))
+	err := s.Save([]store.Message{
+		{Publisher: "TestPublisherName", Order: 1, Content: "first message"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
 	}
-	first := r.NewMessages()
 	if !cmp.Equal(first, []string{"first message"}) {
 		t.Fatalf(cmp.Diff(first, []string{"first message"}))
 	}
-	if len(r.NewMessages()) > 0 {
+	again, err := r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) > 0 {
 		t.Fatalf("shouldn't be reading older messages twice")
 	}
-	r.Store = FakeMessageStore{
-		Messages: []rivulet.Message{
-			{Publisher: "TestPublisherName", Order: 1, Content: "first message"},
-			{Publisher: "TestPublisherName", Order: 2, Content: "second message"},
-		},
+	err = s.Save([]store.Message{
+		{Publisher: "TestPublisherName", Order: 2, Content: "second message"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
 	}
-	second := r.NewMessages()
 	if !cmp.Equal(second, []string{"second message"}) {
 		t.Fatalf(cmp.Diff(second, []string{"second message"}))
 	}
 }
 
+func TestReader_ResumesAfterLastCommittedOrderFromFileCursor(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(helperStoreMessages("p1", 1, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cursor.json")
+	r := rivulet.NewReader("p1", rivulet.WithStore(s), rivulet.WithCursor(rivulet.NewFileCursor(path), "consumer"))
+	messages, err := r.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 5 {
+		t.Fatalf("want 5 messages, got %d", len(messages))
+	}
+	err = r.Commit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save(helperStoreMessages("p1", 6, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := rivulet.NewReader("p1", rivulet.WithStore(s), rivulet.WithCursor(rivulet.NewFileCursor(path), "consumer"))
+	messages, err = restarted.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, m := range messages {
+		got = append(got, m.Order)
+	}
+	if !cmp.Equal(got, []int{6, 7}) {
+		t.Errorf(cmp.Diff([]int{6, 7}, got))
+	}
+}
+
+func TestReader_UncommittedMessagesAreReadAgainAfterRestart(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(helperStoreMessages("p1", 1, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := rivulet.NewDynamoDBCursor(&FakeCursorTable{}, "cursors")
+	r := rivulet.NewReader("p1", rivulet.WithStore(s), rivulet.WithCursor(cursor, "consumer"))
+	_, err = r.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Commit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save(helperStoreMessages("p1", 4, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := rivulet.NewReader("p1", rivulet.WithStore(s), rivulet.WithCursor(cursor, "consumer"))
+	messages, err := restarted.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Order != 4 {
+		t.Errorf("want the 2 uncommitted messages from order 4, got %v", messages)
+	}
+}
+
+func TestReader_HoldsMessagesBehindAGapUntilItIsFilled(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(append(helperStoreMessages("p1", 1, 2), helperStoreMessages("p1", 4, 5)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rivulet.NewReader("p1", rivulet.WithStore(s))
+	got, err := r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, []string{"message 1", "message 2"}) {
+		t.Errorf(cmp.Diff([]string{"message 1", "message 2"}, got))
+	}
+	if !cmp.Equal(r.Gaps(), []rivulet.Gap{{From: 3, To: 3}}) {
+		t.Errorf(cmp.Diff([]rivulet.Gap{{From: 3, To: 3}}, r.Gaps()))
+	}
+	err = s.Save(helperStoreMessages("p1", 3, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, []string{"message 3", "message 4", "message 5"}) {
+		t.Errorf(cmp.Diff([]string{"message 3", "message 4", "message 5"}, got))
+	}
+	if len(r.Gaps()) != 0 {
+		t.Errorf("want no gaps, got %v", r.Gaps())
+	}
+}
+
+func TestReader_SkipsGapOnceReorderWindowOverflows(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(append(helperStoreMessages("p1", 1, 1), helperStoreMessages("p1", 4, 6)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped []rivulet.Gap
+	r := rivulet.NewReader("p1",
+		rivulet.WithStore(s),
+		rivulet.WithReorderWindow(2, time.Hour),
+		rivulet.WithGapHandler(func(g rivulet.Gap) { skipped = append(skipped, g) }),
+	)
+	messages, err := r.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, m := range messages {
+		got = append(got, m.Order)
+	}
+	if !cmp.Equal(got, []int{1, 4, 5, 6}) {
+		t.Errorf(cmp.Diff([]int{1, 4, 5, 6}, got))
+	}
+	if !cmp.Equal(skipped, []rivulet.Gap{{From: 2, To: 3}}) {
+		t.Errorf(cmp.Diff([]rivulet.Gap{{From: 2, To: 3}}, skipped))
+	}
+}
+
+func TestReader_SkipsGapOnceReorderTimeoutPasses(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(append(helperStoreMessages("p1", 1, 1), helperStoreMessages("p1", 3, 3)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped []rivulet.Gap
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := rivulet.NewReader("p1",
+		rivulet.WithStore(s),
+		rivulet.WithReorderWindow(100, time.Minute),
+		rivulet.WithGapHandler(func(g rivulet.Gap) { skipped = append(skipped, g) }),
+		rivulet.WithReaderClock(func() time.Time { return now }),
+	)
+	got, err := r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, []string{"message 1"}) {
+		t.Errorf(cmp.Diff([]string{"message 1"}, got))
+	}
+	now = now.Add(time.Minute)
+	got, err = r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, []string{"message 3"}) {
+		t.Errorf(cmp.Diff([]string{"message 3"}, got))
+	}
+	if !cmp.Equal(skipped, []rivulet.Gap{{From: 2, To: 2}}) {
+		t.Errorf(cmp.Diff([]rivulet.Gap{{From: 2, To: 2}}, skipped))
+	}
+}
+
+func TestReader_StartsAtTheLowestOrderOfAStreamTrimmedByRetention(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore(store.WithCapacity(3))
+	err := s.Save(helperStoreMessages("p1", 1, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped []rivulet.Gap
+	r := rivulet.NewReader("p1",
+		rivulet.WithStore(s),
+		rivulet.WithGapHandler(func(g rivulet.Gap) { skipped = append(skipped, g) }),
+	)
+	got, err := r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"message 8", "message 9", "message 10"}
+	if !cmp.Equal(got, want) {
+		t.Errorf(cmp.Diff(want, got))
+	}
+	if len(skipped) > 0 || len(r.Gaps()) > 0 {
+		t.Errorf("want no gaps in a trimmed stream, skipped %v and waiting on %v", skipped, r.Gaps())
+	}
+}
+
+func TestReader_BuiltAsAStructLiteralWaitsForGapsToFill(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(append(helperStoreMessages("p1", 1, 1), helperStoreMessages("p1", 3, 3)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &rivulet.Reader{PublisherName: "p1", Store: s}
+	got, err := r.NewMessages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, []string{"message 1"}) {
+		t.Errorf(cmp.Diff([]string{"message 1"}, got))
+	}
+	want := []rivulet.Gap{{From: 2, To: 2}}
+	if !cmp.Equal(r.Gaps(), want) {
+		t.Errorf(cmp.Diff(want, r.Gaps()))
+	}
+}
+
+func TestFollow_DeliversMessagesAsTheyAreSavedToANotifyingStore(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Polling never comes round again, so only notifications can wake the Follower.
+	f := rivulet.Follow(ctx, s, "p1", rivulet.WithPollInterval(time.Hour, time.Hour))
+	for i := 1; i <= 3; i++ {
+		err := s.Save(helperStoreMessages("p1", i, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := <-f.Messages()
+		if msg.Content != fmt.Sprintf("message %d", i) {
+			t.Fatalf("want message %d, got %q", i, msg.Content)
+		}
+	}
+	cancel()
+	for range f.Messages() {
+	}
+	if f.Err() != nil {
+		t.Errorf("want no error after cancellation, got %v", f.Err())
+	}
+}
+
+func TestFollow_PollsStoresThatCannotNotify(t *testing.T) {
+	t.Parallel()
+	s := PollingStore{store.NewMemoryStore()}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f := rivulet.Follow(ctx, s, "p1", rivulet.WithPollInterval(time.Millisecond, 10*time.Millisecond))
+	err := s.Save(helperStoreMessages("p1", 1, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for msg := range f.Messages() {
+		got = append(got, msg.Order)
+		if len(got) == 5 {
+			cancel()
+		}
+	}
+	if !cmp.Equal(got, []int{1, 2, 3, 4, 5}) {
+		t.Error(cmp.Diff([]int{1, 2, 3, 4, 5}, got))
+	}
+}
+
+func TestFollow_CommitsDeliveredMessagesToCursor(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(helperStoreMessages("p1", 1, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := rivulet.NewFileCursor(filepath.Join(t.TempDir(), "cursor.json"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f := rivulet.Follow(ctx, s, "p1", rivulet.WithCursor(cursor, "tail"))
+	for i := 0; i < 3; i++ {
+		<-f.Messages()
+	}
+	err = s.Save(helperStoreMessages("p1", 4, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-f.Messages()
+	cancel()
+	for range f.Messages() {
+	}
+	order, err := cursor.Load(context.Background(), "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order < 3 {
+		t.Errorf("want the first batch committed, got cursor at %d", order)
+	}
+}
+
+func TestFollow_StopsWithAnErrorWhenTheStoreFails(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f := rivulet.Follow(ctx, BrokenStore{}, "p1")
+	for range f.Messages() {
+		t.Error("want no messages from a broken store")
+	}
+	if f.Err() == nil {
+		t.Error("want an error from a broken store")
+	}
+}
+
 func TestParseQueryResults(t *testing.T) {
 	t.Parallel()
 	results := &dynamodb.QueryOutput{
@@ -86,7 +407,10 @@ func TestRead(t *testing.T) {
 	req := rivulet.Query("PublisherName")
 	want := &dynamodb.QueryInput{
 		TableName:              aws.String("rivulet"),
-		KeyConditionExpression: aws.String("Publisher = :publisher"),
+		KeyConditionExpression: aws.String("#publisher = :publisher"),
+		ExpressionAttributeNames: map[string]string{
+			"#publisher": "Publisher",
+		},
 		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
 			":publisher": &ddbTypes.AttributeValueMemberS{Value: "PublisherName"},
 		},
@@ -98,8 +422,59 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestRangeQuery_UsesTheConfiguredTableAndAttributeNames(t *testing.T) {
+	t.Parallel()
+	req := rivulet.RangeQuery("PublisherName", store.Range{From: 5},
+		store.WithTable("events"),
+		store.WithAttributeNames(store.AttributeNames{Publisher: "pk", Order: "sk"}),
+	)
+	want := &dynamodb.QueryInput{
+		TableName:              aws.String("events"),
+		KeyConditionExpression: aws.String("#publisher = :publisher AND #order >= :from"),
+		ExpressionAttributeNames: map[string]string{
+			"#publisher": "pk",
+			"#order":     "sk",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":publisher": &ddbTypes.AttributeValueMemberS{Value: "PublisherName"},
+			":from":      &ddbTypes.AttributeValueMemberN{Value: "5"},
+		},
+	}
+	ignore := cmpopts.IgnoreUnexported(dynamodb.QueryInput{}, ddbTypes.AttributeValueMemberS{}, ddbTypes.AttributeValueMemberN{})
+	if !cmp.Equal(req, want, ignore) {
+		t.Errorf(cmp.Diff(req, want, ignore))
+	}
+}
+
+func TestRangeQuery(t *testing.T) {
+	t.Parallel()
+	req := rivulet.RangeQuery("PublisherName", store.Range{From: 5, To: 9, Reverse: true})
+	want := &dynamodb.QueryInput{
+		TableName:              aws.String("rivulet"),
+		KeyConditionExpression: aws.String("#publisher = :publisher AND #order BETWEEN :from AND :to"),
+		ExpressionAttributeNames: map[string]string{
+			"#publisher": "Publisher",
+			"#order":     "Order",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":publisher": &ddbTypes.AttributeValueMemberS{Value: "PublisherName"},
+			":from":      &ddbTypes.AttributeValueMemberN{Value: "5"},
+			":to":        &ddbTypes.AttributeValueMemberN{Value: "9"},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	ignore := cmpopts.IgnoreUnexported(dynamodb.QueryInput{}, ddbTypes.AttributeValueMemberS{}, ddbTypes.AttributeValueMemberN{})
+	if !cmp.Equal(req, want, ignore) {
+		t.Errorf(cmp.Diff(req, want, ignore))
+	}
+}
+
 func TestSetupEventBridgeInfrastructure(t *testing.T) {
 	t.Parallel()
+	account := os.Getenv("RIVULET_AWS_ACCOUNT")
+	if account == "" {
+		t.Skip("RIVULET_AWS_ACCOUNT is not set")
+	}
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
 		t.Fatal(err)
@@ -107,7 +482,7 @@ func TestSetupEventBridgeInfrastructure(t *testing.T) {
 	cfg.Region = "us-west-2"
 	eb := eventbridge.NewFromConfig(cfg)
 	p := rivulet.NewEventBridgePublisher("test", eb)
-	err = rivulet.SetupEventBridgeReceiverInfrastructure(cfg, p)
+	err = rivulet.SetupEventBridgeReceiverInfrastructure(cfg, p, rivulet.InfraConfig{Account: account})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -254,8 +629,63 @@ func TestTransport_NetworkTransport(t *testing.T) {
 		{Publisher: "test", Order: 1, Content: "first line"},
 		{Publisher: "test", Order: 2, Content: "second line"},
 	}
-	if !cmp.Equal(want, got) {
-		t.Fatalf(cmp.Diff(want, got))
+	if !cmp.Equal(want, got, ignoreMetadata) {
+		t.Fatalf(cmp.Diff(want, got, ignoreMetadata))
+	}
+}
+
+func TestNetworkReceiver_DeliversMessagesFromNetworkTransportToSubscriber(t *testing.T) {
+	t.Parallel()
+	receiver := rivulet.NewNetworkReceiver()
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	s := rivulet.NewNetworkSubscriber(receiver, store.NewMemoryStore())
+
+	p, _ := rivulet.NewMemoryPublisher("network", rivulet.WithNetworkTransport(server.URL))
+	for _, line := range []string{"first line", "second line"} {
+		err := p.Publish(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	err := s.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Store.Messages("network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Order < got[j].Order })
+	want := []store.Message{
+		{Publisher: "network", Order: 1, Content: "first line"},
+		{Publisher: "network", Order: 2, Content: "second line"},
+	}
+	ignore := cmpopts.IgnoreFields(store.Message{}, "ID", "Timestamp")
+	if !cmp.Equal(want, got, ignore) {
+		t.Fatalf(cmp.Diff(want, got, ignore))
+	}
+}
+
+func TestNetworkReceiver_RejectsInvalidMessages(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(rivulet.NewNetworkReceiver())
+	defer server.Close()
+	for name, body := range map[string]string{
+		"malformed JSON":    `{"Publisher":`,
+		"missing publisher": `{"Order":1,"Content":"a line"}`,
+		"negative order":    `{"Publisher":"p1","Order":-1,"Content":"a line"}`,
+	} {
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", name, http.StatusBadRequest, resp.StatusCode)
+		}
 	}
 }
 
@@ -269,7 +699,7 @@ func TestTransport_EventBridgeTransport_RealClientSatsfiesInterface(t *testing.T
 func TestTransport_EventBridgeTransport(t *testing.T) {
 	t.Parallel()
 	client := &DummyEventBridge{}
-	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client))
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client), withFixedMetadata())
 	for _, line := range []string{"first line", "second line"} {
 		err := p.Publish(line)
 		if err != nil {
@@ -277,8 +707,8 @@ func TestTransport_EventBridgeTransport(t *testing.T) {
 		}
 	}
 	want := []*eventbridge.PutEventsInput{
-		helperPutEventsInput(`{"Publisher":"p1","Order":1,"Content":"first line"}`),
-		helperPutEventsInput(`{"Publisher":"p1","Order":2,"Content":"second line"}`),
+		helperPutEventsInput(`{"Publisher":"p1","Order":1,"Content":"first line","ID":"id","Timestamp":"2024-05-01T00:00:00Z"}`),
+		helperPutEventsInput(`{"Publisher":"p1","Order":2,"Content":"second line","ID":"id","Timestamp":"2024-05-01T00:00:00Z"}`),
 	}
 	got := client.Input
 	ignore := cmpopts.IgnoreUnexported(types.PutEventsRequestEntry{}, eventbridge.PutEventsInput{})
@@ -364,7 +794,7 @@ func TestEventBridgeTransport_CanTakeUserProvidedMessageTransform(t *testing.T)
 		}
 		return string(data), nil
 	}
-	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client, rivulet.WithTransform(transform)))
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client, rivulet.WithTransform(transform)), withFixedMetadata())
 	err := p.Publish("a line")
 	if err != nil {
 		t.Fatal(err)
@@ -373,27 +803,96 @@ func TestEventBridgeTransport_CanTakeUserProvidedMessageTransform(t *testing.T)
 	if len(got) != 1 {
 		t.Fatalf("expected 1 input, got %d", len(got))
 	}
-	want := `{"Original":{"Publisher":"p1","Order":1,"Content":"a line"},"SomeArbitraryAdditionalField":"arbitrary"}`
+	want := `{"Original":{"Publisher":"p1","Order":1,"Content":"a line","ID":"id","Timestamp":"2024-05-01T00:00:00Z"},"SomeArbitraryAdditionalField":"arbitrary"}`
 	if *got[0].Entries[0].Detail != want {
 		t.Errorf("expected %q, got %q", want, *got[0].Entries[0].Detail)
 	}
 }
 
-func TestEventBridgeTransport_AWellDefinedUserTransformErroringIsHandledByPublish(t *testing.T) {
+func TestEventBridgeSubscriber_DecodesEnvelopedMessagesByDefault(t *testing.T) {
 	t.Parallel()
 	client := &DummyEventBridge{}
-	transform := func(rivulet.Message) (string, error) {
-		return "", fmt.Errorf("a user transform that correctly handles its errors")
-	}
-	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client, rivulet.WithTransform(transform)))
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client, rivulet.WithTransform(rivulet.EnvelopeTransform("rivulet"))))
 	err := p.Publish("a line")
-	if err == nil {
-		t.Errorf("got nil, want error")
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func TestEventBridgeTransport_APoorlyDefinedUserTransformIsCaughtByPublish(t *testing.T) {
-	t.Parallel()
+	s := store.NewMemoryStore()
+	sub := rivulet.NewEventBridgeSubscriber(helperEvent(t, client.Input[0]), s)
+	err = sub.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "a line" {
+		t.Errorf("want the enveloped message stored, got %v", messages)
+	}
+}
+
+func TestEventBridgeSubscriber_DecodesCustomTransformsWithPairedDecoder(t *testing.T) {
+	t.Parallel()
+	client := &DummyEventBridge{}
+	transform := func(m rivulet.Message) (string, error) {
+		return fmt.Sprintf(`{"line":%q,"from":%q,"n":%d}`, m.Content, m.Publisher, m.Order), nil
+	}
+	decoder := func(detail []byte) (rivulet.Message, error) {
+		var event struct {
+			Line string
+			From string
+			N    int
+		}
+		err := json.Unmarshal(detail, &event)
+		return rivulet.Message{Publisher: event.From, Order: event.N, Content: event.Line}, err
+	}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client, rivulet.WithTransform(transform)))
+	err := p.Publish("a line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got rivulet.Message
+	sub := rivulet.NewEventBridgeSubscriber(helperEvent(t, client.Input[0]), nil, rivulet.WithDecoder(decoder))
+	sub.Handle(func(_ context.Context, m rivulet.Message) error {
+		got = m
+		return nil
+	})
+	err = sub.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := rivulet.Message{Publisher: "p1", Order: 1, Content: "a line"}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestEventBridgeSubscriber_RejectsDetailNoDecoderUnderstands(t *testing.T) {
+	t.Parallel()
+	event := events.EventBridgeEvent{ID: "event", Detail: json.RawMessage(`{"something":"else"}`)}
+	sub := rivulet.NewEventBridgeSubscriber(event, store.NewMemoryStore())
+	err := sub.Receive(context.Background())
+	if err == nil {
+		t.Error("want an error for an event detail that isn't a message")
+	}
+}
+
+func TestEventBridgeTransport_AWellDefinedUserTransformErroringIsHandledByPublish(t *testing.T) {
+	t.Parallel()
+	client := &DummyEventBridge{}
+	transform := func(rivulet.Message) (string, error) {
+		return "", fmt.Errorf("a user transform that correctly handles its errors")
+	}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client, rivulet.WithTransform(transform)))
+	err := p.Publish("a line")
+	if err == nil {
+		t.Errorf("got nil, want error")
+	}
+}
+
+func TestEventBridgeTransport_APoorlyDefinedUserTransformIsCaughtByPublish(t *testing.T) {
+	t.Parallel()
 	client := &DummyEventBridge{}
 	transform := func(rivulet.Message) (string, error) {
 		return "", nil
@@ -405,6 +904,817 @@ func TestEventBridgeTransport_APoorlyDefinedUserTransformIsCaughtByPublish(t *te
 	}
 }
 
+func TestPublisher_PublishBatchSendsEventBridgeEntriesInChunksOfTen(t *testing.T) {
+	t.Parallel()
+	client := &DummyEventBridge{}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client), withFixedMetadata())
+	var lines []string
+	for i := 0; i < 23; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i+1))
+	}
+	results, err := p.PublishBatch(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 23 {
+		t.Fatalf("expected 23 results, got %d", len(results))
+	}
+	var sizes []int
+	for _, input := range client.Input {
+		sizes = append(sizes, len(input.Entries))
+	}
+	if !cmp.Equal(sizes, []int{10, 10, 3}) {
+		t.Errorf(cmp.Diff([]int{10, 10, 3}, sizes))
+	}
+	want := `{"Publisher":"p1","Order":23,"Content":"line 23","ID":"id","Timestamp":"2024-05-01T00:00:00Z"}`
+	if got := *client.Input[2].Entries[2].Detail; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if p.Counter() != 23 {
+		t.Errorf("publisher should have published 23 messages, got %d", p.Counter())
+	}
+}
+
+func TestPublisher_PublishBatchReportsWhichEntriesFailed(t *testing.T) {
+	t.Parallel()
+	client := &PartiallyBrokenEventBridge{FailEntry: 1}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client))
+	results, err := p.PublishBatch([]string{"first line", "second line", "third line"})
+	if err == nil {
+		t.Fatal("got nil, want error")
+	}
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r.Message.Content)
+		}
+	}
+	if !cmp.Equal(failed, []string{"second line"}) {
+		t.Errorf(cmp.Diff([]string{"second line"}, failed))
+	}
+}
+
+func TestPublisher_PublishBatchOverNetworkReachesReceiver(t *testing.T) {
+	t.Parallel()
+	receiver := rivulet.NewNetworkReceiver()
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithNetworkTransport(server.URL))
+	results, err := p.PublishBatch([]string{"first line", "second line"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	got, _ := receiver.Receive(ctx)
+	want := []rivulet.Message{
+		{Publisher: "p1", Order: 1, Content: "first line"},
+		{Publisher: "p1", Order: 2, Content: "second line"},
+	}
+	if !cmp.Equal(want, got, ignoreMetadata) {
+		t.Fatalf(cmp.Diff(want, got, ignoreMetadata))
+	}
+}
+
+func TestPublisher_PublishBatchFallsBackToPublishForPlainTransports(t *testing.T) {
+	t.Parallel()
+	transport := &RecordingTransport{}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithTransport(transport))
+	_, err := p.PublishBatch([]string{"first line", "second line"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []rivulet.Message{
+		{Publisher: "p1", Order: 1, Content: "first line"},
+		{Publisher: "p1", Order: 2, Content: "second line"},
+	}
+	if !cmp.Equal(want, transport.Messages, ignoreMetadata) {
+		t.Fatalf(cmp.Diff(want, transport.Messages, ignoreMetadata))
+	}
+}
+
+func TestPublisher_PublishContextAbandonsSlowNetworkRequests(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	p, _ := rivulet.NewMemoryPublisher("test", rivulet.WithNetworkTransport(server.URL))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err := p.PublishContext(ctx, "a line")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestNetworkTransport_TimesOutWithConfiguredTimeout(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	p, _ := rivulet.NewMemoryPublisher("test", rivulet.WithNetworkTransport(server.URL, rivulet.WithTimeout(time.Millisecond*50)))
+	err := p.Publish("a line")
+	if err == nil {
+		t.Errorf("got nil, want error")
+	}
+}
+
+func TestPublisher_PublishContextPassesContextToEventBridge(t *testing.T) {
+	t.Parallel()
+	client := &ContextCheckingEventBridge{}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client))
+	ctx, cancel := context.WithCancel(context.Background())
+	err := p.PublishContext(ctx, "a line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	err = p.PublishContext(ctx, "a line")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("want %v, got %v", context.Canceled, err)
+	}
+	_, err = p.PublishBatchContext(ctx, []string{"a line"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("want %v, got %v", context.Canceled, err)
+	}
+	if client.Calls != 1 {
+		t.Errorf("expected 1 call to EventBridge, got %d", client.Calls)
+	}
+	if p.Counter() != 1 {
+		t.Errorf("cancelled publishes should not consume orders, counter is %d", p.Counter())
+	}
+}
+
+func TestInMemoryTransport_PublishContextGivesUpWhenBufferIsFull(t *testing.T) {
+	t.Parallel()
+	transport := rivulet.NewMemoryTransport()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	var err error
+	for i := 0; i < 1_001 && err == nil; i++ {
+		err = transport.PublishContext(ctx, rivulet.Message{Publisher: "p1", Order: i + 1})
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestPublisher_StampsMessagesWithIDTimestampAndHeaders(t *testing.T) {
+	t.Parallel()
+	transport := &RecordingTransport{}
+	published := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	p, _ := rivulet.NewMemoryPublisher("p1",
+		rivulet.WithTransport(transport),
+		rivulet.WithClock(func() time.Time { return published }),
+		rivulet.WithHeaders(map[string]string{"env": "test", "team": "platform"}),
+	)
+	err := p.PublishWithHeaders(context.Background(), "first line", map[string]string{"team": "on-call"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Publish("second line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := transport.Messages[0], transport.Messages[1]
+	if first.ID == "" || first.ID == second.ID {
+		t.Errorf("messages should have unique IDs, got %q and %q", first.ID, second.ID)
+	}
+	if !first.Timestamp.Equal(published) {
+		t.Errorf("want timestamp %v, got %v", published, first.Timestamp)
+	}
+	wantHeaders := map[string]string{"env": "test", "team": "on-call"}
+	if !cmp.Equal(wantHeaders, first.Headers) {
+		t.Errorf(cmp.Diff(wantHeaders, first.Headers))
+	}
+	wantHeaders = map[string]string{"env": "test", "team": "platform"}
+	if !cmp.Equal(wantHeaders, second.Headers) {
+		t.Errorf(cmp.Diff(wantHeaders, second.Headers))
+	}
+}
+
+func TestSubscriber_PersistsMessageMetadata(t *testing.T) {
+	t.Parallel()
+	receiver := rivulet.NewNetworkReceiver()
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	s := rivulet.NewNetworkSubscriber(receiver, store.NewMemoryStore())
+	p, _ := rivulet.NewMemoryPublisher("p1",
+		rivulet.WithNetworkTransport(server.URL),
+		rivulet.WithHeaders(map[string]string{"env": "test"}),
+	)
+	err := p.Publish("a line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	err = s.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Store.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("wanted 1 message, got %d", len(got))
+	}
+	if got[0].ID == "" {
+		t.Error("stored message is missing its ID")
+	}
+	if got[0].Timestamp.IsZero() {
+		t.Error("stored message is missing its timestamp")
+	}
+	if got[0].Headers["env"] != "test" {
+		t.Errorf("want header env=test, got %v", got[0].Headers)
+	}
+}
+
+func TestPublisher_FileSequenceContinuesOrderingAfterRestart(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sequence.json")
+	transport := &RecordingTransport{}
+	first := rivulet.NewPublisher("p1", rivulet.WithTransport(transport), rivulet.WithSequenceSource(rivulet.NewFileSequence(path)))
+	for i := 0; i < 3; i++ {
+		err := first.Publish("before restart")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	restarted := rivulet.NewPublisher("p1", rivulet.WithTransport(transport), rivulet.WithSequenceSource(rivulet.NewFileSequence(path)))
+	_, err := restarted.PublishBatch([]string{"after restart", "after restart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orders []int
+	for _, m := range transport.Messages {
+		orders = append(orders, m.Order)
+	}
+	if !cmp.Equal(orders, []int{1, 2, 3, 4, 5}) {
+		t.Errorf(cmp.Diff([]int{1, 2, 3, 4, 5}, orders))
+	}
+	if restarted.Counter() != 5 {
+		t.Errorf("want counter 5, got %d", restarted.Counter())
+	}
+}
+
+func TestPublisher_DynamoDBSequenceSharesOrdersBetweenPublishers(t *testing.T) {
+	t.Parallel()
+	table := &FakeSequenceTable{}
+	sequence := rivulet.NewDynamoDBSequence(table, "sequences")
+	transport := &RecordingTransport{}
+	hostA := rivulet.NewPublisher("p1", rivulet.WithTransport(transport), rivulet.WithSequenceSource(sequence))
+	hostB := rivulet.NewPublisher("p1", rivulet.WithTransport(transport), rivulet.WithSequenceSource(sequence))
+	for _, p := range []*rivulet.Publisher{hostA, hostB, hostA} {
+		err := p.Publish("a line")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var orders []int
+	for _, m := range transport.Messages {
+		orders = append(orders, m.Order)
+	}
+	if !cmp.Equal(orders, []int{1, 2, 3}) {
+		t.Errorf(cmp.Diff([]int{1, 2, 3}, orders))
+	}
+	if table.Tables["sequences"] != 3 {
+		t.Errorf("expected 3 UpdateItem calls against table sequences, got %v", table.Tables)
+	}
+}
+
+func TestPublisher_FailsToPublishWhenSequenceIsUnavailable(t *testing.T) {
+	t.Parallel()
+	transport := &RecordingTransport{}
+	sequence := rivulet.NewDynamoDBSequence(&FakeSequenceTable{Err: errors.New("table unavailable")}, "sequences")
+	p := rivulet.NewPublisher("p1", rivulet.WithTransport(transport), rivulet.WithSequenceSource(sequence))
+	err := p.Publish("a line")
+	if err == nil {
+		t.Errorf("got nil, want error")
+	}
+	if len(transport.Messages) != 0 {
+		t.Errorf("no message should be published without an order, got %d", len(transport.Messages))
+	}
+}
+
+func TestPublisher_ConcurrentPublishesGetUniqueContiguousOrders(t *testing.T) {
+	t.Parallel()
+	transport := &SequenceCheckingTransport{}
+	p := rivulet.NewPublisher("p1", rivulet.WithTransport(transport))
+	publishConcurrently(t, p, 20, 50)
+	orders := transport.Orders()
+	sort.Ints(orders)
+	for i, order := range orders {
+		if order != i+1 {
+			t.Fatalf("want orders 1 to %d without gaps or duplicates, got %d at position %d", len(orders), order, i)
+		}
+	}
+	if p.Counter() != int64(len(orders)) {
+		t.Errorf("want counter %d, got %d", len(orders), p.Counter())
+	}
+}
+
+func TestPublisher_WithOrderedDeliveryHandsMessagesToTransportInOrder(t *testing.T) {
+	t.Parallel()
+	transport := &SequenceCheckingTransport{}
+	p := rivulet.NewPublisher("p1", rivulet.WithTransport(transport), rivulet.WithOrderedDelivery())
+	publishConcurrently(t, p, 20, 50)
+	orders := transport.Orders()
+	if len(orders) != 20*50+20*2 {
+		t.Fatalf("want %d messages, got %d", 20*50+20*2, len(orders))
+	}
+	for i, order := range orders {
+		if order != i+1 {
+			t.Fatalf("transport received order %d at position %d", order, i)
+		}
+	}
+}
+
+// publishConcurrently has each of n goroutines publish count single messages
+// and one batch of two messages.
+func publishConcurrently(t *testing.T, p *rivulet.Publisher, n, count int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for g := 0; g < n; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				err := p.Publish("a line")
+				if err != nil {
+					t.Error(err)
+				}
+			}
+			_, err := p.PublishBatch([]string{"a line", "another line"})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSubscriber_RunDeliversMessagesToHandlersAsTheyArrive(t *testing.T) {
+	t.Parallel()
+	p, s := rivulet.NewMemoryPublisher("p1")
+	s.DrainTimeout = time.Millisecond * 50
+	received := make(chan rivulet.Message)
+	s.Handle(func(ctx context.Context, m rivulet.Message) error {
+		received <- m
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	for _, line := range []string{"first line", "second line"} {
+		err := p.Publish(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case m := <-received:
+			if m.Content != line {
+				t.Errorf("want %q, got %q", line, m.Content)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("handler was not called for %q", line)
+		}
+	}
+	cancel()
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := s.Store.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Errorf("want 2 stored messages, got %d", len(stored))
+	}
+}
+
+func TestSubscriber_RunDrainsBufferedMessagesOnShutdown(t *testing.T) {
+	t.Parallel()
+	p, s := rivulet.NewMemoryPublisher("p1")
+	s.DrainTimeout = time.Millisecond * 50
+	var handled []int
+	s.Handle(func(ctx context.Context, m rivulet.Message) error {
+		handled = append(handled, m.Order)
+		return nil
+	})
+	for i := 0; i < 5; i++ {
+		err := p.Publish("a line")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(handled, []int{1, 2, 3, 4, 5}) {
+		t.Errorf(cmp.Diff([]int{1, 2, 3, 4, 5}, handled))
+	}
+}
+
+func TestSubscriber_RunShutsDownPromptlyWhenNothingIsBuffered(t *testing.T) {
+	t.Parallel()
+	event := events.EventBridgeEvent{ID: "event", Detail: json.RawMessage(`{"Publisher":"p1","Order":1,"Content":"a line"}`)}
+	subscribers := map[string]*rivulet.Subscriber{
+		"memory":      func() *rivulet.Subscriber { _, s := rivulet.NewMemoryPublisher("p1"); return s }(),
+		"network":     rivulet.NewNetworkSubscriber(rivulet.NewNetworkReceiver(), store.NewMemoryStore()),
+		"eventbridge": rivulet.NewEventBridgeSubscriber(event, store.NewMemoryStore()),
+	}
+	for name, s := range subscribers {
+		s.DrainTimeout = 10 * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := s.Run(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: want Run to return soon after its context is done, took %v", name, elapsed)
+		}
+	}
+}
+
+func TestSubscriber_RunReportsHandlerErrorsAndCarriesOn(t *testing.T) {
+	t.Parallel()
+	p, s := rivulet.NewMemoryPublisher("p1")
+	s.DrainTimeout = time.Millisecond * 50
+	s.Handle(func(ctx context.Context, m rivulet.Message) error {
+		if m.Order == 2 {
+			return errors.New("cannot handle the second message")
+		}
+		return nil
+	})
+	var failed []int
+	s.OnError(func(m rivulet.Message, err error) {
+		failed = append(failed, m.Order)
+	})
+	for i := 0; i < 3; i++ {
+		err := p.Publish("a line")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := s.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(failed, []int{2}) {
+		t.Errorf(cmp.Diff([]int{2}, failed))
+	}
+}
+
+func TestSubscriber_RunStopsOnUnreportedHandlerError(t *testing.T) {
+	t.Parallel()
+	p, s := rivulet.NewMemoryPublisher("p1")
+	s.Handle(func(ctx context.Context, m rivulet.Message) error {
+		return errors.New("cannot handle any message")
+	})
+	err := p.Publish("a line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = s.Run(ctx)
+	if err == nil {
+		t.Errorf("got nil, want error")
+	}
+}
+
+func TestEventBus_RoutesPublishedMessagesThroughRulesToSubscribers(t *testing.T) {
+	t.Parallel()
+	bus := rivulet.NewEventBus()
+	err := bus.PutRule("default", "rivulet", `{"source":["rivulet"],"detail-type":["rivulet"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.NewMemoryStore()
+	err = bus.AddTarget("default", "rivulet", rivulet.SubscriberTarget(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(bus, rivulet.WithTransform(rivulet.EnvelopeTransform("rivulet"))))
+	_, err = p.PublishBatch([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Publish("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rivulet.NewReader("p1", rivulet.WithStore(s))
+	got, err := r.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, m := range got {
+		contents = append(contents, m.Content)
+	}
+	want := []string{"a", "b", "c", "d"}
+	if !cmp.Equal(want, contents) {
+		t.Error(cmp.Diff(want, contents))
+	}
+	if failures := bus.Failures(); len(failures) != 0 {
+		t.Errorf("want no delivery failures, got %v", failures)
+	}
+}
+
+func TestEventBus_DeliversOnlyToRulesTheEventMatches(t *testing.T) {
+	t.Parallel()
+	bus := rivulet.NewEventBus()
+	matching, other := store.NewMemoryStore(), store.NewMemoryStore()
+	for name, target := range map[string]struct {
+		pattern string
+		store   store.Store
+	}{
+		"matching": {`{"source":["app"],"detail":{"Publisher":["p1"]}}`, matching},
+		"other":    {`{"source":["other"]}`, other},
+	} {
+		err := bus.PutRule("default", name, target.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = bus.AddTarget("default", name, rivulet.SubscriberTarget(target.store))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(bus, rivulet.WithSource("app")))
+	err := p.Publish("a line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := matching.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("want the message delivered to the matching rule, got %v", got)
+	}
+	got, err = other.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("want no message delivered to the other rule, got %v", got)
+	}
+}
+
+func TestEventBus_ReportsMalformedEntriesAsFailed(t *testing.T) {
+	t.Parallel()
+	bus := rivulet.NewEventBus()
+	out, err := bus.PutEvents(context.Background(), &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{
+			{Source: aws.String("rivulet"), DetailType: aws.String("rivulet"), Detail: aws.String(`{}`)},
+			{Source: aws.String("rivulet"), DetailType: aws.String("rivulet"), Detail: aws.String(`not json`)},
+			{DetailType: aws.String("rivulet"), Detail: aws.String(`{}`)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.FailedEntryCount != 2 {
+		t.Errorf("want 2 failed entries, got %d", out.FailedEntryCount)
+	}
+	if out.Entries[0].EventId == nil || out.Entries[1].ErrorCode == nil || out.Entries[2].ErrorCode == nil {
+		t.Errorf("want the first entry accepted and the rest failed, got %+v", out.Entries)
+	}
+}
+
+func TestEventBus_RecordsTargetFailures(t *testing.T) {
+	t.Parallel()
+	bus := rivulet.NewEventBus()
+	err := bus.PutRule("default", "rivulet", `{"source":["rivulet"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bus.AddTarget("default", "rivulet", rivulet.SubscriberTarget(BrokenStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(bus))
+	err = p.Publish("a line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bus.Failures()) != 1 {
+		t.Errorf("want 1 delivery failure, got %v", bus.Failures())
+	}
+}
+
+func TestEventBus_RejectsInvalidRules(t *testing.T) {
+	t.Parallel()
+	bus := rivulet.NewEventBus()
+	for _, pattern := range []string{
+		`not json`,
+		`{}`,
+		`{"source":"rivulet"}`,
+		`{"source":[]}`,
+		`{"detail":{"Order":[[1]]}}`,
+	} {
+		err := bus.PutRule("default", "rule", pattern)
+		if err == nil {
+			t.Errorf("want an error for pattern %s", pattern)
+		}
+	}
+	err := bus.AddTarget("default", "missing", rivulet.SubscriberTarget(store.NewMemoryStore()))
+	if err == nil {
+		t.Error("want an error adding a target to a rule that doesn't exist")
+	}
+}
+
+func TestPattern_MatchesEventBridgeContentFilters(t *testing.T) {
+	t.Parallel()
+	event := `{
+		"source": "rivulet",
+		"detail-type": "rivulet",
+		"region": "us-west-2",
+		"resources": ["arn:aws:s3:::bucket/a.png", "arn:aws:s3:::bucket/b.txt"],
+		"detail": {"Publisher": "orders-eu", "Order": 7, "Content": "Shipped", "Headers": {"env": "prod"}}
+	}`
+	tests := map[string]struct {
+		pattern string
+		want    bool
+	}{
+		"exact value":                        {`{"source":["rivulet"]}`, true},
+		"one of several values":              {`{"source":["other","rivulet"]}`, true},
+		"different value":                    {`{"source":["other"]}`, false},
+		"nested detail field":                {`{"detail":{"Publisher":["orders-eu"],"Headers":{"env":["prod"]}}}`, true},
+		"nested field missing":               {`{"detail":{"Headers":{"region":["eu"]}}}`, false},
+		"exact number":                       {`{"detail":{"Order":[7]}}`, true},
+		"prefix":                             {`{"detail":{"Publisher":[{"prefix":"orders-"}]}}`, true},
+		"prefix not matching":                {`{"detail":{"Publisher":[{"prefix":"users-"}]}}`, false},
+		"prefix of a number":                 {`{"detail":{"Order":[{"prefix":"7"}]}}`, false},
+		"suffix":                             {`{"detail":{"Publisher":[{"suffix":"-eu"}]}}`, true},
+		"equals ignoring case":               {`{"detail":{"Content":[{"equals-ignore-case":"shipped"}]}}`, true},
+		"anything but a value":               {`{"detail":{"Publisher":[{"anything-but":"orders-us"}]}}`, true},
+		"anything but the value":             {`{"detail":{"Publisher":[{"anything-but":"orders-eu"}]}}`, false},
+		"anything but listed numbers":        {`{"detail":{"Order":[{"anything-but":[1,7]}]}}`, false},
+		"anything but a prefix":              {`{"detail":{"Publisher":[{"anything-but":{"prefix":"users-"}}]}}`, true},
+		"anything but a missing field":       {`{"detail":{"Missing":[{"anything-but":"x"}]}}`, false},
+		"numeric range":                      {`{"detail":{"Order":[{"numeric":[">",0,"<=",7]}]}}`, true},
+		"numeric outside range":              {`{"detail":{"Order":[{"numeric":[">",7]}]}}`, false},
+		"numeric equality":                   {`{"detail":{"Order":[{"numeric":["=",7]}]}}`, true},
+		"numeric of a string":                {`{"detail":{"Content":[{"numeric":[">",0]}]}}`, false},
+		"exists":                             {`{"detail":{"Content":[{"exists":true}]}}`, true},
+		"exists on an object":                {`{"detail":{"Headers":[{"exists":true}]}}`, false},
+		"exists on a missing field":          {`{"detail":{"Missing":[{"exists":true}]}}`, false},
+		"does not exist":                     {`{"detail":{"Missing":[{"exists":false}]}}`, true},
+		"does not exist but does":            {`{"detail":{"Content":[{"exists":false}]}}`, false},
+		"does not exist in a missing object": {`{"detail":{"Missing":{"x":[{"exists":false}]}}}`, true},
+		"exists in a missing object":         {`{"detail":{"Missing":{"x":[{"exists":true}]}}}`, false},
+		"does not exist in a non-object":     {`{"detail":{"Content":{"x":[{"exists":false}]}}}`, true},
+		"does not exist two objects down":    {`{"Missing":{"Headers":{"x":[{"exists":false}]}}}`, true},
+		"any element of an array":            {`{"resources":[{"suffix":".png"}]}`, true},
+		"no element of an array":             {`{"resources":[{"suffix":".gif"}]}`, false},
+		"every field must match":             {`{"source":["rivulet"],"region":["eu-west-1"]}`, false},
+	}
+	for name, tc := range tests {
+		p, err := rivulet.ParsePattern(tc.pattern)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := p.Match([]byte(event))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: want %t, got %t", name, tc.want, got)
+		}
+	}
+}
+
+func TestParsePattern_RejectsSyntaxEventBridgeWouldReject(t *testing.T) {
+	t.Parallel()
+	for _, pattern := range []string{
+		`{"detail":{"Order":[{"numeric":[">"]}]}}`,
+		`{"detail":{"Order":[{"numeric":["~",1]}]}}`,
+		`{"detail":{"Order":[{"numeric":[">","1"]}]}}`,
+		`{"detail":{"Publisher":[{"prefix":1}]}}`,
+		`{"detail":{"Publisher":[{"exists":"yes"}]}}`,
+		`{"detail":{"Publisher":[{"anything-but":[]}]}}`,
+		`{"detail":{"Publisher":[{"anything-but":{"numeric":[">",1]}}]}}`,
+		`{"detail":{"Publisher":[{"wildcard":"*"}]}}`,
+		`{"detail":{"Publisher":[{"prefix":"a","suffix":"b"}]}}`,
+		`{"detail":{}}`,
+	} {
+		_, err := rivulet.ParsePattern(pattern)
+		if err == nil {
+			t.Errorf("want an error for pattern %s", pattern)
+		}
+	}
+}
+
+func TestPattern_DefaultRulePatternMatchesWhatEventBridgeTransportSends(t *testing.T) {
+	t.Parallel()
+	p, err := rivulet.ParsePattern(rivulet.DefaultRulePattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &DummyEventBridge{}
+	publisher, _ := rivulet.NewMemoryPublisher("p1", rivulet.WithEventBridgeTransport(client))
+	err = publisher.Publish("a line")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := json.Marshal(helperEvent(t, client.Input[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := p.Match(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Errorf("want %s to match %s", rivulet.DefaultRulePattern, event)
+	}
+}
+
+func TestSubscriber_FilterDropsMessagesNotMatchingThePattern(t *testing.T) {
+	t.Parallel()
+	p, err := rivulet.ParsePattern(`{"detail":{"Content":[{"anything-but":{"prefix":"DEBUG"}}]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher, subscriber := rivulet.NewMemoryPublisher("p1")
+	subscriber.Filter(p)
+	var handled []string
+	subscriber.Handle(func(_ context.Context, m rivulet.Message) error {
+		handled = append(handled, m.Content)
+		return nil
+	})
+	for _, line := range []string{"INFO started", "DEBUG ticking", "INFO stopped"} {
+		err := publisher.Publish(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = subscriber.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"INFO started", "INFO stopped"}
+	if !cmp.Equal(want, handled) {
+		t.Error(cmp.Diff(want, handled))
+	}
+	saved, err := subscriber.Store.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 {
+		t.Errorf("want only the 2 matching messages saved, got %v", saved)
+	}
+}
+
+var ignoreMetadata = cmpopts.IgnoreFields(rivulet.Message{}, "ID", "Timestamp")
+
+// withFixedMetadata makes a Publisher stamp every message with the same ID and
+// Timestamp so that tests can compare serialised messages exactly.
+func withFixedMetadata() rivulet.PublisherOptions {
+	return func(p *rivulet.Publisher) {
+		rivulet.WithClock(func() time.Time { return time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC) })(p)
+		rivulet.WithIDGenerator(func() string { return "id" })(p)
+	}
+}
+
+func helperStoreMessages(publisher string, from, to int) []store.Message {
+	var messages []store.Message
+	for i := from; i <= to; i++ {
+		messages = append(messages, store.Message{Publisher: publisher, Order: i, Content: fmt.Sprintf("message %d", i)})
+	}
+	return messages
+}
+
 func groupByPublisher(messages []rivulet.Message) map[string][]string {
 	result := make(map[string][]string)
 	for _, m := range messages {
@@ -436,6 +1746,156 @@ func (b *BrokenEventBridge) PutEvents(ctx context.Context, input *eventbridge.Pu
 	}, nil
 }
 
+type PartiallyBrokenEventBridge struct {
+	FailEntry int
+}
+
+func (b *PartiallyBrokenEventBridge) PutEvents(ctx context.Context, input *eventbridge.PutEventsInput, opts ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	out := &eventbridge.PutEventsOutput{}
+	for i := range input.Entries {
+		if i == b.FailEntry {
+			out.FailedEntryCount++
+			out.Entries = append(out.Entries, types.PutEventsResultEntry{
+				ErrorCode:    aws.String("400"),
+				ErrorMessage: aws.String("ThrottlingException"),
+			})
+			continue
+		}
+		out.Entries = append(out.Entries, types.PutEventsResultEntry{EventId: aws.String(fmt.Sprint(i))})
+	}
+	return out, nil
+}
+
+type ContextCheckingEventBridge struct {
+	Calls int
+}
+
+func (c *ContextCheckingEventBridge) PutEvents(ctx context.Context, input *eventbridge.PutEventsInput, opts ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.Calls++
+	return &eventbridge.PutEventsOutput{}, nil
+}
+
+type FakeSequenceTable struct {
+	mu       sync.Mutex
+	Err      error
+	Tables   map[string]int
+	counters map[string]int
+}
+
+func (f *FakeSequenceTable) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counters == nil {
+		f.counters = map[string]int{}
+		f.Tables = map[string]int{}
+	}
+	f.Tables[*input.TableName]++
+	publisher := input.Key["Publisher"].(*ddbTypes.AttributeValueMemberS).Value
+	n, err := strconv.Atoi(input.ExpressionAttributeValues[":n"].(*ddbTypes.AttributeValueMemberN).Value)
+	if err != nil {
+		return nil, err
+	}
+	f.counters[publisher] += n
+	return &dynamodb.UpdateItemOutput{
+		Attributes: map[string]ddbTypes.AttributeValue{
+			"Sequence": &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(f.counters[publisher])},
+		},
+	}, nil
+}
+
+// SequenceCheckingTransport records the order of every message it is handed,
+// and is safe for concurrent use.
+type SequenceCheckingTransport struct {
+	mu     sync.Mutex
+	orders []int
+}
+
+func (s *SequenceCheckingTransport) Publish(m rivulet.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders = append(s.orders, m.Order)
+	return nil
+}
+
+func (s *SequenceCheckingTransport) Orders() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.orders...)
+}
+
+type FakeCursorTable struct {
+	mu    sync.Mutex
+	items map[string]map[string]ddbTypes.AttributeValue
+}
+
+func (f *FakeCursorTable) GetItem(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := input.Key["Reader"].(*ddbTypes.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: f.items[key]}, nil
+}
+
+func (f *FakeCursorTable) PutItem(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.items == nil {
+		f.items = map[string]map[string]ddbTypes.AttributeValue{}
+	}
+	key := input.Item["Reader"].(*ddbTypes.AttributeValueMemberS).Value
+	f.items[key] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// PollingStore hides the Notify method of the store it wraps.
+type PollingStore struct {
+	store.Store
+}
+
+type BrokenStore struct{}
+
+func (BrokenStore) Save([]store.Message) error {
+	return errors.New("store unavailable")
+}
+
+func (BrokenStore) Messages(string) ([]store.Message, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func (BrokenStore) Range(context.Context, string, store.Range) ([]store.Message, error) {
+	return nil, errors.New("store unavailable")
+}
+
+type RecordingTransport struct {
+	Messages []rivulet.Message
+}
+
+func (r *RecordingTransport) Publish(m rivulet.Message) error {
+	r.Messages = append(r.Messages, m)
+	return nil
+}
+
+// helperEvent returns the event EventBridge delivers to a Rule's target
+// for the only entry of the input.
+func helperEvent(t *testing.T, input *eventbridge.PutEventsInput) events.EventBridgeEvent {
+	t.Helper()
+	if len(input.Entries) != 1 {
+		t.Fatalf("want 1 entry, got %d", len(input.Entries))
+	}
+	entry := input.Entries[0]
+	return events.EventBridgeEvent{
+		ID:         "event",
+		Source:     aws.ToString(entry.Source),
+		DetailType: aws.ToString(entry.DetailType),
+		Detail:     json.RawMessage(aws.ToString(entry.Detail)),
+	}
+}
+
 func helperPutEventsInput(detail string) *eventbridge.PutEventsInput {
 	return &eventbridge.PutEventsInput{
 		Entries: []types.PutEventsRequestEntry{
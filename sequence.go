@@ -0,0 +1,163 @@
+package rivulet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+// SequenceSource hands out the orders a [Publisher] stamps on its messages.
+// An implementation must never hand out the same order twice for a publisher,
+// so that messages don't collide in a [store.Store], even if the publisher
+// is restarted or runs on more than one host.
+type SequenceSource interface {
+	// Next reserves n consecutive orders for the named publisher
+	// and returns the last of them.
+	Next(ctx context.Context, publisher string, n int) (int, error)
+}
+
+// WithSequenceSource is a functional option specifying where a [Publisher]
+// gets the orders of its messages from. By default orders are kept in memory
+// and start again from 1 whenever the process restarts.
+func WithSequenceSource(s SequenceSource) PublisherOptions {
+	return func(p *Publisher) {
+		p.sequence = s
+	}
+}
+
+// MemorySequence is a [SequenceSource] that keeps its counters in memory.
+// It is the default, and is only suitable for publishers whose orders
+// don't need to survive a restart.
+type MemorySequence struct {
+	mu       sync.Mutex
+	counters map[string]int
+}
+
+// NewMemorySequence creates a [MemorySequence] with every counter at zero.
+func NewMemorySequence() *MemorySequence {
+	return &MemorySequence{counters: map[string]int{}}
+}
+
+// Next reserves n orders for the publisher.
+func (s *MemorySequence) Next(_ context.Context, publisher string, n int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[publisher] += n
+	return s.counters[publisher], nil
+}
+
+// FileSequence is a [SequenceSource] that persists its counters as a JSON
+// object in a file, so that a publisher restarted on the same host
+// continues where it left off. The file is rewritten atomically on every
+// reservation. A FileSequence must not be shared between processes.
+type FileSequence struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSequence creates a [FileSequence] backed by the file at path.
+// The file is created on first use if it doesn't exist.
+func NewFileSequence(path string) *FileSequence {
+	return &FileSequence{path: path}
+}
+
+// Next reserves n orders for the publisher, persisting the new counter
+// before returning it.
+func (s *FileSequence) Next(_ context.Context, publisher string, n int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counters, err := readCounters(s.path)
+	if err != nil {
+		return 0, err
+	}
+	counters[publisher] += n
+	err = writeCounters(s.path, counters)
+	if err != nil {
+		return 0, err
+	}
+	return counters[publisher], nil
+}
+
+// readCounters reads a JSON object of named counters from the file at path.
+// A missing file holds no counters.
+func readCounters(path string) (map[string]int, error) {
+	counters := map[string]int{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return counters, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &counters)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt counter file %s: %w", path, err)
+	}
+	return counters, nil
+}
+
+// writeCounters atomically replaces the file at path with the counters.
+func writeCounters(path string, counters map[string]int) error {
+	data, err := json.Marshal(counters)
+	if err != nil {
+		return err
+	}
+	return store.WriteFileAtomic(path, data)
+}
+
+// DynamoDBSequenceClient is the subset of the DynamoDB API used by a [DynamoDBSequence].
+type DynamoDBSequenceClient interface {
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
+// DynamoDBSequence is a [SequenceSource] that keeps one atomic counter item
+// per publisher in a DynamoDB table, so that a publisher's orders stay
+// unique across restarts and across every host publishing under its name.
+// The table needs a string partition key named Publisher.
+type DynamoDBSequence struct {
+	client DynamoDBSequenceClient
+	table  string
+}
+
+// NewDynamoDBSequence creates a [DynamoDBSequence] that keeps its counters in the given table.
+func NewDynamoDBSequence(client DynamoDBSequenceClient, table string) *DynamoDBSequence {
+	return &DynamoDBSequence{
+		client: client,
+		table:  table,
+	}
+}
+
+// Next atomically adds n to the publisher's counter item and returns the new value.
+func (s *DynamoDBSequence) Next(ctx context.Context, publisher string, n int) (int, error) {
+	out, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]types.AttributeValue{
+			"Publisher": &types.AttributeValueMemberS{Value: publisher},
+		},
+		UpdateExpression: aws.String("ADD #sequence :n"),
+		ExpressionAttributeNames: map[string]string{
+			"#sequence": "Sequence",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":n": &types.AttributeValueMemberN{Value: strconv.Itoa(n)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, err
+	}
+	sequence, ok := out.Attributes["Sequence"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, fmt.Errorf("sequence for %q missing from UpdateItem response", publisher)
+	}
+	return strconv.Atoi(sequence.Value)
+}
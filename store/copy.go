@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// CopyStats reports what [Copy] did for one publisher.
+type CopyStats struct {
+	Publisher string
+	// Copied is how many messages were saved to the destination.
+	Copied int
+	// Resumed is the order the copy resumed after, or zero if it started
+	// from the beginning of the range.
+	Resumed int
+	// Last is the order of the last message copied, or zero if none were.
+	Last int
+	// Source and Destination are how many messages each store holds in the
+	// range once the copy is done. They are only counted with [WithVerify].
+	// With a Limit, only the part of the range up to Last is counted.
+	Source      int
+	Destination int
+}
+
+// DefaultCopyPageSize is how many messages [Copy] reads and saves at a time by default.
+const DefaultCopyPageSize = 1000
+
+// ErrCountMismatch is returned by a verified [Copy] when the destination
+// doesn't hold as many messages in the range as the source.
+var ErrCountMismatch = errors.New("destination doesn't hold as many messages as the source")
+
+// CopyOptions are functional options for configuring [Copy] and [Replicate].
+type CopyOptions func(*copier)
+
+type copier struct {
+	pageSize int
+	resume   bool
+	verify   bool
+	progress func(CopyStats)
+}
+
+// WithPageSize is a functional option specifying how many messages are
+// read from the source and saved to the destination at a time.
+func WithPageSize(n int) CopyOptions {
+	return func(c *copier) {
+		c.pageSize = n
+	}
+}
+
+// WithResume is a functional option that resumes an interrupted copy.
+// Messages are copied in order a page at a time, so the highest order the
+// destination holds in the range marks how far the copy got, and copying
+// starts again after it. The destination must not hold messages in the
+// range from anywhere else.
+func WithResume() CopyOptions {
+	return func(c *copier) {
+		c.resume = true
+	}
+}
+
+// WithVerify is a functional option that counts the messages each store
+// holds in the range once the copy is done, failing with [ErrCountMismatch]
+// if they differ. Counting reads the range from both stores again.
+func WithVerify() CopyOptions {
+	return func(c *copier) {
+		c.verify = true
+	}
+}
+
+// WithProgress is a functional option specifying a function called with
+// the stats so far after each page is saved.
+func WithProgress(f func(CopyStats)) CopyOptions {
+	return func(c *copier) {
+		c.progress = f
+	}
+}
+
+// Copy streams the publisher's messages selected by r from src to dst,
+// oldest first, a page at a time, so that a stream of any size can be
+// moved between stores, for example from a [DynamoDBStore] to a
+// [FileStore] for offline analysis. A Reverse range is copied oldest first
+// all the same.
+func Copy(ctx context.Context, dst, src Store, publisher string, r Range, opts ...CopyOptions) (CopyStats, error) {
+	c := copier{pageSize: DefaultCopyPageSize}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	r.Reverse = false
+	stats := CopyStats{Publisher: publisher}
+	from := r
+	if c.resume {
+		copied, err := dst.Range(ctx, publisher, Range{From: r.From, To: r.To, Limit: 1, Reverse: true})
+		if err != nil {
+			return stats, fmt.Errorf("finding where to resume copying %s: %w", publisher, err)
+		}
+		if len(copied) > 0 {
+			stats.Resumed = copied[0].Order
+			from.From = stats.Resumed + 1
+		}
+	}
+	if r.To == 0 || from.From <= r.To {
+		err := Pages(ctx, src, publisher, from, c.pageSize, func(page []Message) error {
+			err := dst.Save(page)
+			if err != nil {
+				return err
+			}
+			stats.Copied += len(page)
+			stats.Last = page[len(page)-1].Order
+			if c.progress != nil {
+				c.progress(stats)
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("copying %s: %w", publisher, err)
+		}
+	}
+	if !c.verify {
+		return stats, nil
+	}
+	var err error
+	if covered := max(stats.Last, stats.Resumed); r.Limit > 0 && covered > 0 {
+		// The limit stopped the copy short of the range, so count only what it covered.
+		r.To = covered
+		r.Limit = 0
+	}
+	stats.Source, err = count(ctx, src, publisher, r, c.pageSize)
+	if err != nil {
+		return stats, fmt.Errorf("counting %s in source: %w", publisher, err)
+	}
+	stats.Destination, err = count(ctx, dst, publisher, r, c.pageSize)
+	if err != nil {
+		return stats, fmt.Errorf("counting %s in destination: %w", publisher, err)
+	}
+	if stats.Source != stats.Destination {
+		return stats, fmt.Errorf("%w: %s has %d messages in the source and %d in the destination", ErrCountMismatch, publisher, stats.Source, stats.Destination)
+	}
+	return stats, nil
+}
+
+// Replicate copies each publisher's messages selected by r from src to dst
+// in turn, as [Copy] does. It carries on past a publisher that fails, and
+// returns the stats of every publisher along with the errors joined.
+func Replicate(ctx context.Context, dst, src Store, publishers []string, r Range, opts ...CopyOptions) ([]CopyStats, error) {
+	var all []CopyStats
+	var errs []error
+	for _, publisher := range publishers {
+		stats, err := Copy(ctx, dst, src, publisher, r, opts...)
+		all = append(all, stats)
+		if err != nil {
+			if ctx.Err() != nil {
+				return all, err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return all, errors.Join(errs...)
+}
+
+// count returns how many of the publisher's messages s holds in r.
+func count(ctx context.Context, s Store, publisher string, r Range, pageSize int) (int, error) {
+	n := 0
+	err := Pages(ctx, s, publisher, r, pageSize, func(page []Message) error {
+		n += len(page)
+		return nil
+	})
+	return n, err
+}
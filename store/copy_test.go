@@ -0,0 +1,135 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+func TestCopy_StreamsARangeBetweenStoresAndVerifiesCounts(t *testing.T) {
+	t.Parallel()
+	src := store.NewMemoryStore()
+	err := src.Save(helperMessages("p1", 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := helperFileStore(t, filepath.Join(t.TempDir(), "copy.jsonl"))
+	var pages int
+	stats, err := store.Copy(context.Background(), dst, src, "p1", store.Range{From: 11, To: 40},
+		store.WithPageSize(7),
+		store.WithVerify(),
+		store.WithProgress(func(store.CopyStats) { pages++ }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := store.CopyStats{Publisher: "p1", Copied: 30, Last: 40, Source: 30, Destination: 30}
+	if !cmp.Equal(want, stats) {
+		t.Error(cmp.Diff(want, stats))
+	}
+	if pages != 5 {
+		t.Errorf("want 5 pages copied, got %d", pages)
+	}
+	messages, err := dst.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 30 || messages[0].Order != 11 {
+		t.Errorf("want orders 11 to 40 copied, got %v", orders(messages))
+	}
+}
+
+func TestCopy_ResumesAfterTheLastOrderTheDestinationHolds(t *testing.T) {
+	t.Parallel()
+	src := store.NewMemoryStore()
+	err := src.Save(helperMessages("p1", 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := &FlakyStore{Store: store.NewMemoryStore(), FailAfter: 2}
+	_, err = store.Copy(context.Background(), dst, src, "p1", store.Range{}, store.WithPageSize(5))
+	if err == nil {
+		t.Fatal("want the interrupted copy to fail")
+	}
+	dst.FailAfter = 0
+	stats, err := store.Copy(context.Background(), dst, src, "p1", store.Range{}, store.WithPageSize(5), store.WithResume(), store.WithVerify())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := store.CopyStats{Publisher: "p1", Copied: 10, Resumed: 10, Last: 20, Source: 20, Destination: 20}
+	if !cmp.Equal(want, stats) {
+		t.Error(cmp.Diff(want, stats))
+	}
+}
+
+func TestCopy_VerifyCountsOnlyWhatALimitedCopyCovered(t *testing.T) {
+	t.Parallel()
+	src := store.NewMemoryStore()
+	err := src.Save(helperMessages("p1", 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := store.NewMemoryStore()
+	stats, err := store.Copy(context.Background(), dst, src, "p1", store.Range{From: 3, Limit: 8}, store.WithPageSize(5), store.WithVerify())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := store.CopyStats{Publisher: "p1", Copied: 8, Last: 10, Source: 8, Destination: 8}
+	if !cmp.Equal(want, stats) {
+		t.Error(cmp.Diff(want, stats))
+	}
+}
+
+func TestCopy_VerifyReportsCountMismatch(t *testing.T) {
+	t.Parallel()
+	src := store.NewMemoryStore()
+	err := src.Save(helperMessages("p1", 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := store.NewMemoryStore(store.WithCapacity(3))
+	_, err = store.Copy(context.Background(), dst, src, "p1", store.Range{}, store.WithVerify())
+	if !errors.Is(err, store.ErrCountMismatch) {
+		t.Errorf("want %v, got %v", store.ErrCountMismatch, err)
+	}
+}
+
+func TestReplicate_CopiesEveryPublisher(t *testing.T) {
+	t.Parallel()
+	src := store.NewMemoryStore()
+	err := src.Save(append(helperMessages("p1", 3), helperMessages("p2", 4)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := store.NewMemoryStore()
+	stats, err := store.Replicate(context.Background(), dst, src, []string{"p1", "p2"}, store.Range{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []store.CopyStats{
+		{Publisher: "p1", Copied: 3, Last: 3},
+		{Publisher: "p2", Copied: 4, Last: 4},
+	}
+	if !cmp.Equal(want, stats) {
+		t.Error(cmp.Diff(want, stats))
+	}
+}
+
+// FlakyStore fails every Save once FailAfter saves have succeeded.
+type FlakyStore struct {
+	store.Store
+	FailAfter int
+	saves     int
+}
+
+func (f *FlakyStore) Save(m []store.Message) error {
+	if f.FailAfter > 0 && f.saves >= f.FailAfter {
+		return errors.New("store unavailable")
+	}
+	f.saves++
+	return f.Store.Save(m)
+}
@@ -2,8 +2,11 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -11,63 +14,490 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// DynamoDBClient is the subset of the DynamoDB API used by a DynamoDBStore.
+// It is satisfied by [*dynamodb.Client], and by fakes in tests.
+type DynamoDBClient interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// DynamoDBStore is a Store backed by a DynamoDB table with a string
+// partition key holding the Publisher and a number sort key holding the Order.
 type DynamoDBStore struct {
-	client *dynamodb.Client
-	table  string
+	client     DynamoDBClient
+	cfg        *aws.Config
+	table      string
+	names      AttributeNames
+	idempotent bool
+	retention  Retention
+	now        func() time.Time
 }
 
-func NewDynamoDBStore() *DynamoDBStore {
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		panic(err)
+// AttributeNames are the names of the item attributes a DynamoDBStore
+// keeps each field of a [Message] in.
+type AttributeNames struct {
+	Publisher string
+	Order     string
+	Content   string
+	ID        string
+	Timestamp string
+	Headers   string
+	// ExpiresAt holds the time, in seconds since the Unix epoch, after which
+	// DynamoDB's time to live deletes the item. It is only written with a
+	// [Retention] that has a MaxAge.
+	ExpiresAt string
+}
+
+// DefaultAttributeNames name each attribute after the [Message] field it holds.
+var DefaultAttributeNames = AttributeNames{
+	Publisher: "Publisher",
+	Order:     "Order",
+	Content:   "Content",
+	ID:        "ID",
+	Timestamp: "Timestamp",
+	Headers:   "Headers",
+	ExpiresAt: "ExpiresAt",
+}
+
+// DefaultTable is the table a DynamoDBStore uses unless given another with [WithTable].
+const DefaultTable = "rivulet"
+
+// DynamoDBStoreOptions are functional options for configuring a DynamoDBStore.
+type DynamoDBStoreOptions func(*DynamoDBStore)
+
+// WithClient is a functional option specifying the DynamoDB client a DynamoDBStore uses.
+// No AWS configuration is loaded when a client is given.
+func WithClient(client DynamoDBClient) DynamoDBStoreOptions {
+	return func(s *DynamoDBStore) {
+		s.client = client
 	}
-	return &DynamoDBStore{
-		client: dynamodb.NewFromConfig(cfg),
-		table:  "rivulet",
+}
+
+// WithAWSConfig is a functional option specifying the AWS configuration a
+// DynamoDBStore creates its client from, instead of the default configuration.
+func WithAWSConfig(cfg aws.Config) DynamoDBStoreOptions {
+	return func(s *DynamoDBStore) {
+		s.cfg = &cfg
+	}
+}
+
+// WithTable is a functional option specifying the name of the table a DynamoDBStore uses.
+func WithTable(table string) DynamoDBStoreOptions {
+	return func(s *DynamoDBStore) {
+		s.table = table
 	}
 }
 
+// WithAttributeNames is a functional option specifying the attribute names a
+// DynamoDBStore uses. Any name left empty keeps its default.
+func WithAttributeNames(names AttributeNames) DynamoDBStoreOptions {
+	return func(s *DynamoDBStore) {
+		for _, field := range []struct {
+			name *string
+			set  string
+		}{
+			{&s.names.Publisher, names.Publisher},
+			{&s.names.Order, names.Order},
+			{&s.names.Content, names.Content},
+			{&s.names.ID, names.ID},
+			{&s.names.Timestamp, names.Timestamp},
+			{&s.names.Headers, names.Headers},
+			{&s.names.ExpiresAt, names.ExpiresAt},
+		} {
+			if field.set != "" {
+				*field.name = field.set
+			}
+		}
+	}
+}
+
+// WithIdempotentWrites is a functional option specifying that a DynamoDBStore
+// must never overwrite a message it already holds. Saving a message whose
+// Publisher and Order are already stored is a no-op if the Content matches,
+// such as when EventBridge redelivers an event, and fails with [ErrConflict]
+// if it doesn't. Idempotent writes are conditional, so they are made one
+// item at a time rather than in batches.
+func WithIdempotentWrites() DynamoDBStoreOptions {
+	return func(s *DynamoDBStore) {
+		s.idempotent = true
+	}
+}
+
+// WithDynamoDBRetention is a functional option specifying the [Retention]
+// a DynamoDBStore enforces. A MaxAge is enforced by DynamoDB's time to live,
+// which must be enabled on the table for the ExpiresAt attribute: each item
+// is written with the time its message expires. DynamoDB deletes expired
+// items some time after they expire, so Range skips them in the meantime.
+// MaxMessages and MaxBytes are enforced after each Save by deleting the
+// publisher's oldest messages, which means reading back every message the
+// publisher retains, so they suit modest bounds.
+func WithDynamoDBRetention(r Retention) DynamoDBStoreOptions {
+	return func(s *DynamoDBStore) {
+		s.retention = r
+	}
+}
+
+// ErrConflict is returned when saving a message would replace a different
+// message already stored under the same Publisher and Order.
+var ErrConflict = errors.New("a different message is already stored with this publisher and order")
+
+const (
+	// maxBatchWriteItems is the most items DynamoDB accepts in one BatchWriteItem call.
+	maxBatchWriteItems = 25
+	// maxBatchWriteAttempts bounds how many times unprocessed items are resubmitted.
+	maxBatchWriteAttempts = 8
+	// batchWriteBackoff is the delay before the first resubmission, doubling after each.
+	batchWriteBackoff = 50 * time.Millisecond
+)
+
+// NewDynamoDBStore creates a DynamoDBStore. Unless a client is given with
+// [WithClient], one is created from the AWS configuration given with
+// [WithAWSConfig], or else from the default configuration.
+func NewDynamoDBStore(opts ...DynamoDBStoreOptions) (*DynamoDBStore, error) {
+	s := &DynamoDBStore{
+		table: DefaultTable,
+		names: DefaultAttributeNames,
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.client != nil {
+		return s, nil
+	}
+	if s.cfg == nil {
+		cfg, err := config.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		s.cfg = &cfg
+	}
+	s.client = dynamodb.NewFromConfig(*s.cfg)
+	return s, nil
+}
+
+// Save writes messages to the table with BatchWriteItem, 25 at a time,
+// resubmitting any items DynamoDB reports as unprocessed with exponential
+// backoff. If a message appears more than once, the last one is written.
+// With [WithIdempotentWrites], messages are written one at a time instead.
 func (s *DynamoDBStore) Save(m []Message) error {
 	ctx := context.Background()
-	command := &dynamodb.PutItemInput{
-		TableName: aws.String(s.table),
-		Item:      map[string]types.AttributeValue{},
+	err := s.save(ctx, m)
+	if err != nil {
+		return err
 	}
-	for _, msg := range m {
-		command.Item["Publisher"] = &types.AttributeValueMemberS{Value: msg.Publisher}
-		command.Item["Order"] = &types.AttributeValueMemberN{Value: fmt.Sprint(msg.Order)}
-		command.Item["Content"] = &types.AttributeValueMemberS{Value: msg.Content}
+	if !s.retention.limited() {
+		return nil
+	}
+	for _, publisher := range publishers(m) {
+		err = s.retain(ctx, publisher)
+		if err != nil {
+			return fmt.Errorf("enforcing retention for %s: %w", publisher, err)
+		}
+	}
+	return nil
+}
+
+func (s *DynamoDBStore) save(ctx context.Context, m []Message) error {
+	if s.idempotent {
+		return s.saveIdempotent(ctx, m)
+	}
+	items := dedupe(m)
+	for start := 0; start < len(items); start += maxBatchWriteItems {
+		end := min(start+maxBatchWriteItems, len(items))
+		var requests []types.WriteRequest
+		for _, msg := range items[start:end] {
+			requests = append(requests, types.WriteRequest{
+				PutRequest: &types.PutRequest{Item: s.item(msg)},
+			})
+		}
+		err := s.batchWrite(ctx, requests)
+		if err != nil {
+			return err
+		}
 	}
-	_, err := s.client.PutItem(ctx, command)
+	return nil
+}
+
+// item converts a Message into a DynamoDB item, stamped with the time it
+// expires if the store's retention has a MaxAge.
+func (s *DynamoDBStore) item(msg Message) map[string]types.AttributeValue {
+	item := s.names.marshal(msg)
+	if s.retention.MaxAge > 0 && !msg.Timestamp.IsZero() {
+		expires := msg.Timestamp.Add(s.retention.MaxAge).Unix()
+		item[s.names.ExpiresAt] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expires, 10)}
+	}
+	return item
+}
+
+// expired reports whether an item's time to live has passed, though
+// DynamoDB may not have deleted it yet.
+func (s *DynamoDBStore) expired(item map[string]types.AttributeValue, now time.Time) bool {
+	expiresAt, ok := item[s.names.ExpiresAt].(*types.AttributeValueMemberN)
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresAt.Value, 10, 64)
+	return err == nil && expires < now.Unix()
+}
+
+// retain deletes the publisher's oldest messages beyond the store's
+// MaxMessages or MaxBytes, reading the publisher's messages newest first.
+func (s *DynamoDBStore) retain(ctx context.Context, publisher string) error {
+	var entries []retained
+	err := Pages(ctx, s, publisher, Range{Reverse: true}, maxBatchWriteItems*4, func(page []Message) error {
+		for _, msg := range page {
+			entries = append(entries, retained{Order: msg.Order, Size: len(msg.Content)})
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	slices.Reverse(entries)
+	var requests []types.WriteRequest
+	for _, order := range s.retention.evict(entries, s.now()) {
+		requests = append(requests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{Key: map[string]types.AttributeValue{
+				s.names.Publisher: &types.AttributeValueMemberS{Value: publisher},
+				s.names.Order:     &types.AttributeValueMemberN{Value: strconv.Itoa(order)},
+			}},
+		})
+	}
+	for start := 0; start < len(requests); start += maxBatchWriteItems {
+		err = s.batchWrite(ctx, requests[start:min(start+maxBatchWriteItems, len(requests))])
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// batchWrite writes one batch of requests, retrying unprocessed items.
+func (s *DynamoDBStore) batchWrite(ctx context.Context, requests []types.WriteRequest) error {
+	backoff := batchWriteBackoff
+	for attempt := 1; ; attempt++ {
+		out, err := s.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{s.table: requests},
+		})
+		if err != nil {
+			return err
+		}
+		requests = out.UnprocessedItems[s.table]
+		if len(requests) == 0 {
+			return nil
+		}
+		if attempt == maxBatchWriteAttempts {
+			return fmt.Errorf("%d items still unprocessed after %d attempts", len(requests), attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// saveIdempotent writes each message only if nothing is stored under its key yet.
+func (s *DynamoDBStore) saveIdempotent(ctx context.Context, m []Message) error {
+	var errs []error
+	for _, msg := range m {
+		_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(s.table),
+			Item:                s.item(msg),
+			ConditionExpression: aws.String("attribute_not_exists(#publisher)"),
+			ExpressionAttributeNames: map[string]string{
+				"#publisher": s.names.Publisher,
+			},
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		})
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			existing, parseErr := s.names.unmarshal(conditionFailed.Item)
+			if parseErr == nil && existing.Content == msg.Content {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("%w: %s order %d", ErrConflict, msg.Publisher, msg.Order))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dedupe drops all but the last of any messages sharing a Publisher and Order,
+// which DynamoDB refuses to accept in the same batch.
+func dedupe(m []Message) []Message {
+	type key struct {
+		publisher string
+		order     int
+	}
+	last := make(map[key]int, len(m))
+	for i, msg := range m {
+		last[key{msg.Publisher, msg.Order}] = i
+	}
+	unique := make([]Message, 0, len(last))
+	for i, msg := range m {
+		if last[key{msg.Publisher, msg.Order}] == i {
+			unique = append(unique, msg)
+		}
+	}
+	return unique
+}
+
+// Messages returns all of the publisher's messages, following
+// LastEvaluatedKey so that results over 1 MB are not truncated.
 func (s *DynamoDBStore) Messages(publisher string) ([]Message, error) {
-	command := dynamodb.QueryInput{
-		TableName:              aws.String(s.table),
-		KeyConditionExpression: aws.String("Publisher = :publisher"),
+	messages, err := s.Range(context.Background(), publisher, Range{})
+	if err != nil {
+		return []Message{}, err
+	}
+	return messages, nil
+}
+
+// Range returns the publisher's messages selected by r, querying page by
+// page until the range or the limit is exhausted.
+func (s *DynamoDBStore) Range(ctx context.Context, publisher string, r Range) ([]Message, error) {
+	input := s.names.queryInput(s.table, publisher, r)
+	now := s.now()
+	var messages []Message
+	for {
+		if r.Limit > 0 {
+			input.Limit = aws.Int32(int32(r.Limit - len(messages)))
+		}
+		results, err := s.client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range results.Items {
+			if s.expired(item, now) {
+				continue
+			}
+			msg, err := s.names.unmarshal(item)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, msg)
+		}
+		if len(results.LastEvaluatedKey) == 0 || (r.Limit > 0 && len(messages) >= r.Limit) {
+			return messages, nil
+		}
+		input.ExclusiveStartKey = results.LastEvaluatedKey
+	}
+}
+
+// QueryInput builds the query selecting a publisher's messages in the given
+// [Range], from the table and with the attribute names given by [WithTable]
+// and [WithAttributeNames], or else the defaults. Other options are ignored,
+// so no client is created. Pagination and Limit are left to the caller.
+func QueryInput(publisher string, r Range, opts ...DynamoDBStoreOptions) *dynamodb.QueryInput {
+	s := &DynamoDBStore{table: DefaultTable, names: DefaultAttributeNames}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s.names.queryInput(s.table, publisher, r)
+}
+
+func (n AttributeNames) queryInput(table, publisher string, r Range) *dynamodb.QueryInput {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("#publisher = :publisher"),
+		ExpressionAttributeNames: map[string]string{
+			"#publisher": n.Publisher,
+		},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":publisher": &types.AttributeValueMemberS{Value: publisher},
 		},
 	}
-	results, err := s.client.Query(context.Background(), &command)
+	var condition string
+	switch {
+	case r.From != 0 && r.To != 0:
+		condition = " AND #order BETWEEN :from AND :to"
+	case r.From != 0:
+		condition = " AND #order >= :from"
+	case r.To != 0:
+		condition = " AND #order <= :to"
+	}
+	if condition != "" {
+		input.KeyConditionExpression = aws.String(*input.KeyConditionExpression + condition)
+		input.ExpressionAttributeNames["#order"] = n.Order
+	}
+	if r.From != 0 {
+		input.ExpressionAttributeValues[":from"] = &types.AttributeValueMemberN{Value: fmt.Sprint(r.From)}
+	}
+	if r.To != 0 {
+		input.ExpressionAttributeValues[":to"] = &types.AttributeValueMemberN{Value: fmt.Sprint(r.To)}
+	}
+	if r.Reverse {
+		input.ScanIndexForward = aws.Bool(false)
+	}
+	return input
+}
+
+// marshal converts a Message into a DynamoDB item. Metadata attributes
+// are only written when they are set.
+func (n AttributeNames) marshal(msg Message) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		n.Publisher: &types.AttributeValueMemberS{Value: msg.Publisher},
+		n.Order:     &types.AttributeValueMemberN{Value: fmt.Sprint(msg.Order)},
+		n.Content:   &types.AttributeValueMemberS{Value: msg.Content},
+	}
+	if msg.ID != "" {
+		item[n.ID] = &types.AttributeValueMemberS{Value: msg.ID}
+	}
+	if !msg.Timestamp.IsZero() {
+		item[n.Timestamp] = &types.AttributeValueMemberS{Value: msg.Timestamp.Format(time.RFC3339Nano)}
+	}
+	if len(msg.Headers) > 0 {
+		headers := make(map[string]types.AttributeValue, len(msg.Headers))
+		for k, v := range msg.Headers {
+			headers[k] = &types.AttributeValueMemberS{Value: v}
+		}
+		item[n.Headers] = &types.AttributeValueMemberM{Value: headers}
+	}
+	return item
+}
+
+// unmarshal converts a DynamoDB item written by marshal back into a Message.
+func (n AttributeNames) unmarshal(item map[string]types.AttributeValue) (Message, error) {
+	var msg Message
+	publisher, ok := item[n.Publisher].(*types.AttributeValueMemberS)
+	if !ok {
+		return msg, fmt.Errorf("item has no %s string attribute", n.Publisher)
+	}
+	order, ok := item[n.Order].(*types.AttributeValueMemberN)
+	if !ok {
+		return msg, fmt.Errorf("item has no %s number attribute", n.Order)
+	}
+	o, err := strconv.ParseInt(order.Value, 10, 64)
 	if err != nil {
-		return []Message{}, err
+		return msg, err
 	}
-	var messages []Message
-	for _, item := range results.Items {
-		order, err := strconv.ParseInt(item["Order"].(*types.AttributeValueMemberN).Value, 10, 64)
+	msg.Publisher = publisher.Value
+	msg.Order = int(o)
+	if content, ok := item[n.Content].(*types.AttributeValueMemberS); ok {
+		msg.Content = content.Value
+	}
+	if id, ok := item[n.ID].(*types.AttributeValueMemberS); ok {
+		msg.ID = id.Value
+	}
+	if ts, ok := item[n.Timestamp].(*types.AttributeValueMemberS); ok {
+		msg.Timestamp, err = time.Parse(time.RFC3339Nano, ts.Value)
 		if err != nil {
-			panic(err)
+			return msg, err
 		}
-		messages = append(messages, Message{
-			Publisher: item["Publisher"].(*types.AttributeValueMemberS).Value,
-			Order:     int(order),
-			Content:   item["Content"].(*types.AttributeValueMemberS).Value,
-		})
 	}
-	return messages, nil
+	if headers, ok := item[n.Headers].(*types.AttributeValueMemberM); ok {
+		msg.Headers = make(map[string]string, len(headers.Value))
+		for k, v := range headers.Value {
+			if s, ok := v.(*types.AttributeValueMemberS); ok {
+				msg.Headers[k] = s.Value
+			}
+		}
+	}
+	return msg, nil
 }
@@ -0,0 +1,411 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+func TestDynamoDBStore_SaveWritesEveryMessageInBatchesOf25(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	s := helperDynamoDBStore(t, fake)
+	err := s.Save(helperMessages("p1", 60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(fake.BatchSizes, []int{25, 25, 10}) {
+		t.Errorf(cmp.Diff([]int{25, 25, 10}, fake.BatchSizes))
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 60 {
+		t.Errorf("want 60 stored messages, got %d", len(messages))
+	}
+}
+
+func TestDynamoDBStore_SaveRetriesUnprocessedItems(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	fake.Unprocessed = 3
+	s := helperDynamoDBStore(t, fake)
+	err := s.Save(helperMessages("p1", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(fake.BatchSizes, []int{10, 3}) {
+		t.Errorf(cmp.Diff([]int{10, 3}, fake.BatchSizes))
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 10 {
+		t.Errorf("want 10 stored messages, got %d", len(messages))
+	}
+}
+
+// Saving used to reuse one PutItem input for every message, so only the
+// last message of a Save was ever written.
+func TestDynamoDBStore_SaveWritesEveryMessageNotJustTheLast(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	s := helperDynamoDBStore(t, fake)
+	err := s.Save(helperMessages("p1", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := helperMessages("p1", 3)
+	if !cmp.Equal(want, messages) {
+		t.Error(cmp.Diff(want, messages))
+	}
+}
+
+func TestDynamoDBStore_SaveKeepsTheLastOfDuplicateMessages(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	s := helperDynamoDBStore(t, fake)
+	err := s.Save([]store.Message{
+		{Publisher: "p1", Order: 1, Content: "first"},
+		{Publisher: "p1", Order: 1, Content: "second"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "second" {
+		t.Errorf("want only the last duplicate stored, got %v", messages)
+	}
+}
+
+func TestDynamoDBStore_IdempotentWritesNeverOverwriteDifferentContent(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	s := helperDynamoDBStore(t, fake, store.WithIdempotentWrites())
+	original := store.Message{Publisher: "p1", Order: 1, Content: "original"}
+	err := s.Save([]store.Message{original})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save([]store.Message{original})
+	if err != nil {
+		t.Errorf("redelivering the same message should succeed, got %v", err)
+	}
+	err = s.Save([]store.Message{{Publisher: "p1", Order: 1, Content: "imposter"}})
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("want %v, got %v", store.ErrConflict, err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "original" {
+		t.Errorf("want only the original message stored, got %v", messages)
+	}
+}
+
+func TestDynamoDBStore_MessagesFollowsPagination(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	fake.PageSize = 7
+	s := helperDynamoDBStore(t, fake)
+	err := s.Save(helperMessages("p1", 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 30 {
+		t.Errorf("want 30 messages, got %d", len(messages))
+	}
+	if fake.Queries != 5 {
+		t.Errorf("want 5 paginated queries, got %d", fake.Queries)
+	}
+}
+
+func TestDynamoDBStore_RangeSelectsOrdersAcrossPages(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	fake.PageSize = 2
+	s := helperDynamoDBStore(t, fake)
+	err := s.Save(helperMessages("p1", 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Range(context.Background(), "p1", store.Range{From: 5, To: 15, Limit: 5, Reverse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{15, 14, 13, 12, 11}
+	if !cmp.Equal(want, orders(messages)) {
+		t.Error(cmp.Diff(want, orders(messages)))
+	}
+}
+
+func TestDynamoDBStore_UsesConfiguredTableAndAttributeNames(t *testing.T) {
+	t.Parallel()
+	names := store.AttributeNames{Publisher: "pk", Order: "sk", Content: "body"}
+	fake := NewFakeDynamoDB()
+	fake.Names = store.DefaultAttributeNames
+	fake.Names.Publisher, fake.Names.Order, fake.Names.Content = "pk", "sk", "body"
+	s := helperDynamoDBStore(t, fake, store.WithTable("staging-rivulet"), store.WithAttributeNames(names))
+	err := s.Save([]store.Message{{Publisher: "p1", Order: 1, Content: "a line"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, ok := fake.Tables["staging-rivulet"]["p1/1"]
+	if !ok {
+		t.Fatalf("message not written to table staging-rivulet: %v", fake.Tables)
+	}
+	if body, ok := item["body"].(*types.AttributeValueMemberS); !ok || body.Value != "a line" {
+		t.Errorf("content not written to attribute body: %v", item)
+	}
+	messages, err := s.Range(context.Background(), "p1", store.Range{From: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "a line" {
+		t.Errorf("want the message read back, got %v", messages)
+	}
+}
+
+func TestDynamoDBStore_QueriesAttributeNamesThatAreReservedWords(t *testing.T) {
+	t.Parallel()
+	names := store.AttributeNames{Publisher: "Source", Order: "Name"}
+	fake := NewFakeDynamoDB()
+	fake.Names = store.DefaultAttributeNames
+	fake.Names.Publisher, fake.Names.Order = "Source", "Name"
+	s := helperDynamoDBStore(t, fake, store.WithAttributeNames(names))
+	err := s.Save(helperMessages("p1", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 3 {
+		t.Errorf("want 3 messages, got %v", messages)
+	}
+	messages, err = s.Range(context.Background(), "p1", store.Range{From: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Errorf("want 2 messages, got %v", messages)
+	}
+}
+
+func TestDynamoDBStore_MaxAgeStampsItemsWithTimeToLiveAndSkipsExpiredOnes(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	s := helperDynamoDBStore(t, fake, store.WithDynamoDBRetention(store.Retention{MaxAge: time.Hour}))
+	published := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	err := s.Save([]store.Message{
+		{Publisher: "p1", Order: 1, Content: "stale", Timestamp: published},
+		{Publisher: "p1", Order: 2, Content: "fresh", Timestamp: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt, ok := fake.Tables[store.DefaultTable]["p1/1"]["ExpiresAt"].(*types.AttributeValueMemberN)
+	want := strconv.FormatInt(published.Add(time.Hour).Unix(), 10)
+	if !ok || expiresAt.Value != want {
+		t.Errorf("want ExpiresAt %s, got %v", want, fake.Tables[store.DefaultTable]["p1/1"])
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{2}, orders(messages)) {
+		t.Error(cmp.Diff([]int{2}, orders(messages)))
+	}
+}
+
+func TestDynamoDBStore_MaxMessagesDeletesOldestMessages(t *testing.T) {
+	t.Parallel()
+	fake := NewFakeDynamoDB()
+	fake.PageSize = 3
+	s := helperDynamoDBStore(t, fake, store.WithDynamoDBRetention(store.Retention{MaxMessages: 4}))
+	err := s.Save(helperMessages("p1", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Tables[store.DefaultTable]) != 4 {
+		t.Errorf("want 4 items left in the table, got %d", len(fake.Tables[store.DefaultTable]))
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{7, 8, 9, 10}, orders(messages)) {
+		t.Error(cmp.Diff([]int{7, 8, 9, 10}, orders(messages)))
+	}
+}
+
+func helperDynamoDBStore(t *testing.T, fake *FakeDynamoDB, opts ...store.DynamoDBStoreOptions) *store.DynamoDBStore {
+	t.Helper()
+	s, err := store.NewDynamoDBStore(append([]store.DynamoDBStoreOptions{store.WithClient(fake)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// FakeDynamoDB is an in-memory stand-in for the parts of DynamoDB a
+// DynamoDBStore uses. Items are keyed by "publisher/order".
+type FakeDynamoDB struct {
+	mu          sync.Mutex
+	Names       store.AttributeNames
+	Tables      map[string]map[string]map[string]types.AttributeValue
+	PageSize    int
+	Unprocessed int
+	BatchSizes  []int
+	Queries     int
+}
+
+func NewFakeDynamoDB() *FakeDynamoDB {
+	return &FakeDynamoDB{
+		Names:  store.DefaultAttributeNames,
+		Tables: map[string]map[string]map[string]types.AttributeValue{},
+	}
+}
+
+func (f *FakeDynamoDB) key(item map[string]types.AttributeValue) string {
+	return item[f.Names.Publisher].(*types.AttributeValueMemberS).Value + "/" + item[f.Names.Order].(*types.AttributeValueMemberN).Value
+}
+
+func (f *FakeDynamoDB) put(table string, item map[string]types.AttributeValue) {
+	if f.Tables[table] == nil {
+		f.Tables[table] = map[string]map[string]types.AttributeValue{}
+	}
+	f.Tables[table][f.key(item)] = item
+}
+
+func (f *FakeDynamoDB) PutItem(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	existing, ok := f.Tables[*input.TableName][f.key(input.Item)]
+	if ok && input.ConditionExpression != nil {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("conditional request failed"), Item: existing}
+	}
+	f.put(*input.TableName, input.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *FakeDynamoDB) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	for table, requests := range input.RequestItems {
+		if len(requests) > 25 {
+			return nil, errors.New("too many items in batch")
+		}
+		f.BatchSizes = append(f.BatchSizes, len(requests))
+		processed := len(requests) - f.Unprocessed
+		f.Unprocessed = 0
+		for _, r := range requests[:processed] {
+			if r.DeleteRequest != nil {
+				delete(f.Tables[table], f.key(r.DeleteRequest.Key))
+				continue
+			}
+			f.put(table, r.PutRequest.Item)
+		}
+		if processed < len(requests) {
+			out.UnprocessedItems[table] = requests[processed:]
+		}
+	}
+	return out, nil
+}
+
+// reservedWords are some of the words DynamoDB won't accept as attribute
+// names in an expression, unless they are given as placeholders.
+var reservedWords = map[string]bool{"NAME": true, "ORDER": true, "SOURCE": true, "TIMESTAMP": true}
+
+func (f *FakeDynamoDB) Query(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Queries++
+	for _, word := range strings.FieldsFunc(aws.ToString(input.KeyConditionExpression), func(r rune) bool { return r == ' ' || r == '(' || r == ')' }) {
+		if reservedWords[strings.ToUpper(word)] {
+			return nil, fmt.Errorf("ValidationException: attribute name is a reserved keyword: %s", word)
+		}
+	}
+	values := input.ExpressionAttributeValues
+	publisher := values[":publisher"].(*types.AttributeValueMemberS).Value
+	bound := func(name string, fallback int) int {
+		v, ok := values[name].(*types.AttributeValueMemberN)
+		if !ok {
+			return fallback
+		}
+		n, _ := strconv.Atoi(v.Value)
+		return n
+	}
+	from, to := bound(":from", -1<<31), bound(":to", 1<<31)
+	var items []map[string]types.AttributeValue
+	for _, item := range f.Tables[*input.TableName] {
+		order, _ := strconv.Atoi(item[f.Names.Order].(*types.AttributeValueMemberN).Value)
+		if item[f.Names.Publisher].(*types.AttributeValueMemberS).Value == publisher && order >= from && order <= to {
+			items = append(items, item)
+		}
+	}
+	orderOf := func(item map[string]types.AttributeValue) int {
+		n, _ := strconv.Atoi(item[f.Names.Order].(*types.AttributeValueMemberN).Value)
+		return n
+	}
+	reverse := input.ScanIndexForward != nil && !*input.ScanIndexForward
+	sort.Slice(items, func(i, j int) bool {
+		if reverse {
+			return orderOf(items[i]) > orderOf(items[j])
+		}
+		return orderOf(items[i]) < orderOf(items[j])
+	})
+	if input.ExclusiveStartKey != nil {
+		start := orderOf(input.ExclusiveStartKey)
+		for i, item := range items {
+			if orderOf(item) == start {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	size := len(items)
+	if f.PageSize > 0 && f.PageSize < size {
+		size = f.PageSize
+	}
+	if input.Limit != nil && int(*input.Limit) < size {
+		size = int(*input.Limit)
+	}
+	out := &dynamodb.QueryOutput{Items: items[:size]}
+	if size < len(items) {
+		last := items[size-1]
+		out.LastEvaluatedKey = map[string]types.AttributeValue{
+			f.Names.Publisher: last[f.Names.Publisher],
+			f.Names.Order:     last[f.Names.Order],
+		}
+	}
+	return out, nil
+}
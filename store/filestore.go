@@ -1,76 +1,357 @@
 package store
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 )
 
+// FileStore is a [Store] that appends messages to a file as JSON lines,
+// one message per line. It keeps an in-memory index of where each
+// publisher's messages are in the file, so that reading one publisher's
+// stream only reads that publisher's lines. Saving a message whose
+// Publisher and Order are already stored replaces it, as with other stores;
+// the older line stays in the file, no longer indexed, until the file is
+// compacted.
 type FileStore struct {
-	input chan (string)
-	mu    *sync.RWMutex
+	mu    sync.RWMutex
+	path  string
 	file  *os.File
-	err   error
+	size  int64
+	live  int64
+	index map[string]map[int]span
+
+	retention Retention
+	now       func() time.Time
+	onCompact func(error)
 }
 
-func (s *FileStore) Receive() {
-	for {
-		data, ok := <-s.input
-		if !ok {
-			return
-		}
-		s.Write(data)
+// span is where a message's line is in a FileStore's file, and what
+// its [Retention] needs to know about the message.
+type span struct {
+	offset    int64
+	length    int
+	timestamp time.Time
+	size      int
+}
+
+// FileStoreOptions are functional options for configuring a [FileStore].
+type FileStoreOptions func(*FileStore)
+
+// WithFileRetention is a functional option specifying the [Retention] a
+// [FileStore] enforces. Messages beyond it are dropped from the index when
+// their publisher next saves, and expired messages are never returned.
+// Their lines are removed from the file when it is compacted.
+func WithFileRetention(r Retention) FileStoreOptions {
+	return func(s *FileStore) {
+		s.retention = r
+	}
+}
+
+// WithCompactionErrorHandler is a functional option registering a function
+// to be told when compacting the file automatically after a Save fails.
+// The saved messages are already durable by then, so the failure doesn't
+// fail the Save, and compaction is tried again on the next one.
+func WithCompactionErrorHandler(f func(error)) FileStoreOptions {
+	return func(s *FileStore) {
+		s.onCompact = f
 	}
 }
 
-func NewFileStore(filename string) (*FileStore, error) {
-	file, err := os.Create(filename)
+// compactThreshold is how many bytes of a FileStore's file must be
+// dropped lines before it is compacted automatically.
+const compactThreshold = 1 << 20
+
+// NewFileStore opens the FileStore in the named file, creating the file if
+// it doesn't exist. Messages already in the file are indexed, so that a
+// store reopened after a restart holds everything saved before it.
+// A line left incomplete by a crash while saving is discarded.
+func NewFileStore(filename string, opts ...FileStoreOptions) (*FileStore, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0o644)
 	if err != nil {
 		return nil, err
 	}
-	return &FileStore{
-		file: file,
-		mu:   &sync.RWMutex{},
-	}, nil
+	s := &FileStore{
+		path:  filename,
+		file:  file,
+		index: map[string]map[int]span{},
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	err = s.load()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening file store %s: %w", filename, err)
+	}
+	return s, nil
 }
 
-func (s *FileStore) Write(data string) error {
+// load indexes every complete line in the file, and truncates the file
+// after the last of them.
+func (s *FileStore) load() error {
+	_, err := s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(s.file)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var msg Message
+		err = json.Unmarshal(data, &msg)
+		if err != nil {
+			return fmt.Errorf("corrupt message on line %d: %w", line, err)
+		}
+		s.add(msg, offset, len(data))
+		offset += int64(len(data))
+	}
+	err = s.file.Truncate(offset)
+	if err != nil {
+		return err
+	}
+	s.size = offset
+	for publisher := range s.index {
+		s.retain(publisher)
+	}
+	return nil
+}
+
+// add indexes the message's line, replacing any earlier line for its order.
+func (s *FileStore) add(msg Message, offset int64, length int) {
+	orders, ok := s.index[msg.Publisher]
+	if !ok {
+		orders = map[int]span{}
+		s.index[msg.Publisher] = orders
+	}
+	if old, ok := orders[msg.Order]; ok {
+		s.live -= int64(old.length)
+	}
+	orders[msg.Order] = span{offset: offset, length: length, timestamp: msg.Timestamp, size: len(msg.Content)}
+	s.live += int64(length)
+}
+
+// retain drops the publisher's messages beyond the store's retention from the index.
+func (s *FileStore) retain(publisher string) {
+	if s.retention == (Retention{}) {
+		return
+	}
+	orders := s.index[publisher]
+	entries := make([]retained, 0, len(orders))
+	for order, at := range orders {
+		entries = append(entries, retained{Order: order, Timestamp: at.timestamp, Size: at.size})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Order < entries[j].Order
+	})
+	for _, order := range s.retention.evict(entries, s.now()) {
+		s.live -= int64(orders[order].length)
+		delete(orders, order)
+	}
+}
+
+// Save appends the messages to the file in a single write, and syncs the
+// file before returning. Once dropped lines make up most of the file,
+// it is compacted; see [WithCompactionErrorHandler].
+func (s *FileStore) Save(m []Message) error {
+	var buf bytes.Buffer
+	offsets := make([]int64, len(m))
+	for i, msg := range m {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		offsets[i] = int64(buf.Len())
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	_, err := s.file.WriteString(data)
+	_, err := s.file.WriteAt(buf.Bytes(), s.size)
+	if err != nil {
+		return err
+	}
+	err = s.file.Sync()
 	if err != nil {
-		s.file.Close()
 		return err
 	}
+	for i, msg := range m {
+		end := int64(buf.Len())
+		if i+1 < len(m) {
+			end = offsets[i+1]
+		}
+		s.add(msg, s.size+offsets[i], int(end-offsets[i]))
+	}
+	s.size += int64(buf.Len())
+	for _, publisher := range publishers(m) {
+		s.retain(publisher)
+	}
+	dead := s.size - s.live
+	if dead >= compactThreshold && dead >= s.live {
+		err = s.compact()
+		if err != nil && s.onCompact != nil {
+			s.onCompact(fmt.Errorf("compacting file store %s: %w", s.path, err))
+		}
+	}
 	return nil
 }
 
-func (s *FileStore) Read() string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	_, err := s.file.Seek(0, 0)
+// publishers returns the distinct publishers of the messages.
+func publishers(m []Message) []string {
+	var names []string
+	for _, msg := range m {
+		if !slices.Contains(names, msg.Publisher) {
+			names = append(names, msg.Publisher)
+		}
+	}
+	return names
+}
+
+// Compact rewrites the file without the lines of replaced messages and
+// of messages dropped by the store's retention. The new file replaces
+// the old atomically, so a crash mid-compaction loses nothing.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+func (s *FileStore) compact() error {
+	type line struct {
+		publisher string
+		order     int
+		at        span
+	}
+	var lines []line
+	for publisher, orders := range s.index {
+		for order, at := range orders {
+			lines = append(lines, line{publisher, order, at})
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].at.offset < lines[j].at.offset
+	})
+	info, err := s.file.Stat()
 	if err != nil {
-		s.err = err
-		return ""
+		return err
 	}
-	data, err := io.ReadAll(s.file)
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
 	if err != nil {
-		s.err = err
-		return ""
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	var offset int64
+	for i, l := range lines {
+		data := make([]byte, l.at.length)
+		_, err = s.file.ReadAt(data, l.at.offset)
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		lines[i].at.offset = offset
+		offset += int64(l.at.length)
+	}
+	err = w.Flush()
+	if err == nil {
+		// CreateTemp makes the file readable only by its owner.
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if err == nil {
+		err = tmp.Sync()
 	}
-	_, err = s.file.Seek(0, 2)
 	if err != nil {
-		s.err = err
-		return ""
+		tmp.Close()
+		return err
+	}
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		tmp.Close()
+		return err
 	}
-	return string(data)
+	s.file.Close()
+	s.file = tmp
+	s.size = offset
+	s.live = offset
+	for _, l := range lines {
+		s.index[l.publisher][l.order] = l.at
+	}
+	return nil
 }
 
-func (s *FileStore) Register(c chan (string)) {
-	s.input = c
+// Messages returns every message the publisher has saved.
+func (s *FileStore) Messages(publisher string) ([]Message, error) {
+	return s.Range(context.Background(), publisher, Range{})
 }
 
+// Range returns the publisher's messages selected by r, reading only
+// the lines of the selected messages.
+func (s *FileStore) Range(_ context.Context, publisher string, r Range) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := s.now()
+	var orders []int
+	for order, at := range s.index[publisher] {
+		if order < r.From || (r.To != 0 && order > r.To) || s.retention.expired(at.timestamp, now) {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	slices.Sort(orders)
+	if r.Reverse {
+		slices.Reverse(orders)
+	}
+	if r.Limit > 0 && len(orders) > r.Limit {
+		orders = orders[:r.Limit]
+	}
+	messages := make([]Message, 0, len(orders))
+	for _, order := range orders {
+		msg, err := s.read(s.index[publisher][order])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (s *FileStore) read(at span) (Message, error) {
+	data := make([]byte, at.length)
+	_, err := s.file.ReadAt(data, at.offset)
+	if err != nil {
+		return Message{}, err
+	}
+	var msg Message
+	err = json.Unmarshal(data, &msg)
+	if err != nil {
+		return Message{}, fmt.Errorf("corrupt message at offset %d: %w", at.offset, err)
+	}
+	return msg, nil
+}
+
+// Close closes the file. The FileStore can't be used afterwards.
 func (s *FileStore) Close() error {
-	s.file.Close()
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
 }
@@ -0,0 +1,237 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+var _ store.Store = (*store.FileStore)(nil)
+
+func TestFileStore_ReopenedStoreHoldsEverythingSavedBefore(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	s := helperFileStore(t, path)
+	err := s.Save(append(helperMessages("p1", 3), helperMessages("p2", 2)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened := helperFileStore(t, path)
+	err = reopened.Save([]store.Message{{Publisher: "p1", Order: 4, Content: "message 4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := reopened.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{1, 2, 3, 4}, orders(messages)) {
+		t.Error(cmp.Diff([]int{1, 2, 3, 4}, orders(messages)))
+	}
+	messages, err = reopened.Messages("p2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(helperMessages("p2", 2), messages) {
+		t.Error(cmp.Diff(helperMessages("p2", 2), messages))
+	}
+}
+
+func TestFileStore_RangeSelectsOrdersInSequence(t *testing.T) {
+	t.Parallel()
+	s := helperFileStore(t, filepath.Join(t.TempDir(), "messages.jsonl"))
+	err := s.Save(helperMessages("p1", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Range(context.Background(), "p1", store.Range{From: 3, To: 8, Limit: 4, Reverse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{8, 7, 6, 5}, orders(messages)) {
+		t.Error(cmp.Diff([]int{8, 7, 6, 5}, orders(messages)))
+	}
+}
+
+func TestFileStore_SavingAnOrderAgainReplacesIt(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	s := helperFileStore(t, path)
+	err := s.Save([]store.Message{{Publisher: "p1", Order: 1, Content: "first"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save([]store.Message{{Publisher: "p1", Order: 1, Content: "second"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	messages, err := helperFileStore(t, path).Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "second" {
+		t.Errorf("want only the second message, got %v", messages)
+	}
+}
+
+func TestFileStore_DiscardsALineTornByACrash(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	s := helperFileStore(t, path)
+	err := s.Save(helperMessages("p1", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(`{"Publisher":"p1","Order":3,"Cont`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	reopened := helperFileStore(t, path)
+	err = reopened.Save([]store.Message{{Publisher: "p1", Order: 3, Content: "message 3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+	messages, err := helperFileStore(t, path).Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{1, 2, 3}, orders(messages)) {
+		t.Error(cmp.Diff([]int{1, 2, 3}, orders(messages)))
+	}
+}
+
+func TestFileStore_CompactionDropsMessagesBeyondRetention(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	s := helperFileStore(t, path, store.WithFileRetention(store.Retention{MaxMessages: 2}))
+	for _, m := range helperMessages("p1", 10) {
+		err := s.Save([]store.Message{m})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size()*4 > before.Size() {
+		t.Errorf("want compaction to shrink the file to a fifth, went from %d to %d bytes", before.Size(), after.Size())
+	}
+	s.Close()
+	messages, err := helperFileStore(t, path).Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{9, 10}, orders(messages)) {
+		t.Error(cmp.Diff([]int{9, 10}, orders(messages)))
+	}
+}
+
+func TestFileStore_CompactionKeepsTheFileMode(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	s := helperFileStore(t, path)
+	err := s.Save(helperMessages("p1", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chmod(path, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("want mode %v after compaction, got %v", os.FileMode(0o640), info.Mode().Perm())
+	}
+}
+
+func TestFileStore_SaveSucceedsWhenAutomaticCompactionFails(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "messages.jsonl")
+	var compactErr error
+	s := helperFileStore(t, path, store.WithCompactionErrorHandler(func(err error) { compactErr = err }))
+	// Without its directory, the store can't create the file it compacts into.
+	err := os.RemoveAll(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := strings.Repeat("x", 1<<20)
+	for i := 0; i < 2; i++ {
+		err = s.Save([]store.Message{{Publisher: "p1", Order: 1, Content: big}})
+		if err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+	}
+	if compactErr == nil {
+		t.Error("want the compaction failure reported to the handler")
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != big {
+		t.Errorf("want the saved message back, got %d messages", len(messages))
+	}
+}
+
+func TestFileStore_RetentionAppliesToMessagesLoadedOnReopen(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	s := helperFileStore(t, path)
+	err := s.Save(helperMessages("p1", 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	reopened := helperFileStore(t, path, store.WithFileRetention(store.Retention{MaxMessages: 3}))
+	messages, err := reopened.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{3, 4, 5}, orders(messages)) {
+		t.Error(cmp.Diff([]int{3, 4, 5}, orders(messages)))
+	}
+}
+
+func helperFileStore(t *testing.T, path string, opts ...store.FileStoreOptions) *store.FileStore {
+	t.Helper()
+	s, err := store.NewFileStore(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
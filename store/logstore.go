@@ -0,0 +1,662 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogStore is a [Store] for high-volume local streams. It appends messages
+// to a directory of segment files, starting a new segment once the current
+// one reaches a size or age limit. Each segment keeps a sparse index of
+// where each publisher's messages are, so that range reads skip segments,
+// and parts of segments, that can't hold the orders asked for.
+//
+// Every record is framed with its length and a checksum, so that a record
+// torn by a crash is detected and truncated when the log is reopened.
+// Saving a message whose Publisher and Order are already stored replaces it,
+// as with other stores.
+type LogStore struct {
+	mu       sync.RWMutex
+	dir      string
+	segments []*segment
+	active   *os.File
+	waiters  waiters
+
+	maxSize   int64
+	maxAge    time.Duration
+	interval  int
+	sync      SyncPolicy
+	retention Retention
+	now       func() time.Time
+}
+
+// SyncPolicy is when a [LogStore] flushes its writes to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncEverySave syncs the active segment before every Save returns,
+	// so that no saved message is lost in a crash. It is the default.
+	SyncEverySave SyncPolicy = iota
+	// SyncOnRotate syncs a segment only when it is full and on Close,
+	// trading the most recent messages in a crash for throughput.
+	SyncOnRotate
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+const (
+	// DefaultSegmentSize is the size at which a [LogStore] starts a new segment by default.
+	DefaultSegmentSize = 64 << 20
+	// DefaultIndexInterval is how many of a publisher's records a [LogStore]
+	// writes to a segment between index entries by default.
+	DefaultIndexInterval = 64
+	// recordHeaderSize is the length and checksum framing each record.
+	recordHeaderSize = 8
+	// maxRecordSize bounds a record's length, so that a corrupt header
+	// isn't mistaken for an enormous record.
+	maxRecordSize = 64 << 20
+)
+
+// LogStoreOptions are functional options for configuring a [LogStore].
+type LogStoreOptions func(*LogStore)
+
+// WithSegmentSize is a functional option specifying the size in bytes at
+// which a [LogStore] starts a new segment. A single Save is never split
+// between segments, so a segment can exceed this by up to one Save.
+func WithSegmentSize(size int64) LogStoreOptions {
+	return func(s *LogStore) {
+		s.maxSize = size
+	}
+}
+
+// WithSegmentAge is a functional option specifying how long a [LogStore]
+// writes to a segment before starting a new one, counted from when the
+// segment was created or the log was opened. By default segments are
+// rotated only by size.
+func WithSegmentAge(age time.Duration) LogStoreOptions {
+	return func(s *LogStore) {
+		s.maxAge = age
+	}
+}
+
+// WithSyncPolicy is a functional option specifying when a [LogStore]
+// syncs its writes to stable storage.
+func WithSyncPolicy(p SyncPolicy) LogStoreOptions {
+	return func(s *LogStore) {
+		s.sync = p
+	}
+}
+
+// WithIndexInterval is a functional option specifying how many of a
+// publisher's records a [LogStore] writes to a segment between index entries.
+// A smaller interval makes range reads faster and the index bigger.
+func WithIndexInterval(n int) LogStoreOptions {
+	return func(s *LogStore) {
+		s.interval = n
+	}
+}
+
+// WithLogRetention is a functional option specifying the [Retention] a
+// [LogStore] enforces. Segments are shared between publishers, so retention
+// is enforced a whole sealed segment at a time: a segment is deleted once
+// every message in it has expired, and the oldest segments are deleted
+// while the log as a whole is bigger than MaxBytes. Expired messages are
+// never returned. MaxMessages is not supported.
+func WithLogRetention(r Retention) LogStoreOptions {
+	return func(s *LogStore) {
+		s.retention = r
+	}
+}
+
+// WithLogClock is a functional option specifying the clock a [LogStore]
+// ages its segments by. It is time.Now by default.
+func WithLogClock(now func() time.Time) LogStoreOptions {
+	return func(s *LogStore) {
+		s.now = now
+	}
+}
+
+// segment is one file of a LogStore, and its index.
+type segment struct {
+	id      int
+	size    int64
+	created time.Time
+	newest  time.Time
+	index   map[string]*segmentIndex
+}
+
+// segmentIndex is where one publisher's records are in a segment.
+type segmentIndex struct {
+	Min         int
+	Max         int
+	Count       int
+	Checkpoints []checkpoint
+}
+
+// checkpoint marks the offset of one of a publisher's records in a segment.
+// Min and Max are the lowest and highest orders of the publisher's records
+// from there up to the next checkpoint, so that a range read can skip the
+// sections that can't hold the orders asked for, even if the publisher's
+// messages were saved out of order.
+type checkpoint struct {
+	Offset int64
+	Min    int
+	Max    int
+}
+
+// indexVersion is the version of the index files a LogStore writes. A
+// segment with an index file of any other version is scanned instead.
+const indexVersion = 1
+
+// NewLogStore opens the LogStore in dir, creating the directory if it
+// doesn't exist. Segments already in the directory are indexed, and
+// whatever a crash left unreadable at the end of the last segment is
+// truncated.
+func NewLogStore(dir string, opts ...LogStoreOptions) (*LogStore, error) {
+	s := &LogStore{
+		dir:      dir,
+		maxSize:  DefaultSegmentSize,
+		interval: DefaultIndexInterval,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.interval = max(s.interval, 1)
+	if s.retention.MaxMessages > 0 {
+		return nil, errors.New("a log store can't limit the number of messages it retains")
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	err = s.open()
+	if err != nil {
+		return nil, fmt.Errorf("opening log store %s: %w", dir, err)
+	}
+	return s, nil
+}
+
+// open indexes the existing segments and opens the last for appending.
+func (s *LogStore) open() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".log")
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	if len(ids) == 0 {
+		return s.create(1)
+	}
+	for i, id := range ids {
+		seg := &segment{id: id, created: s.now()}
+		last := i == len(ids)-1
+		if !last {
+			ok, err := s.loadIndex(seg)
+			if err != nil {
+				return err
+			}
+			if ok {
+				s.segments = append(s.segments, seg)
+				continue
+			}
+		}
+		err = s.scan(seg, last)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+	}
+	s.active, err = os.OpenFile(s.segmentPath(ids[len(ids)-1], ".log"), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	return s.retain()
+}
+
+// create starts a new, empty active segment.
+func (s *LogStore) create(id int) error {
+	file, err := os.OpenFile(s.segmentPath(id, ".log"), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	s.active = file
+	s.segments = append(s.segments, &segment{
+		id:      id,
+		created: s.now(),
+		index:   map[string]*segmentIndex{},
+	})
+	return nil
+}
+
+// loadIndex reads the index written when a segment was rotated.
+// It reports false if the segment has no usable index file.
+func (s *LogStore) loadIndex(seg *segment) (bool, error) {
+	data, err := os.ReadFile(s.segmentPath(seg.id, ".index"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var stored storedIndex
+	err = json.Unmarshal(data, &stored)
+	if err != nil || stored.Version != indexVersion {
+		return false, nil
+	}
+	seg.size = stored.Size
+	seg.newest = stored.Newest
+	seg.index = stored.Index
+	return true, nil
+}
+
+// scan rebuilds a segment's index from its records. The last segment is
+// truncated at the first record that is torn or won't decode, as a crash
+// while saving leaves; in any other segment that is corruption.
+func (s *LogStore) scan(seg *segment, last bool) error {
+	path := s.segmentPath(seg.id, ".log")
+	file, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	seg.index = map[string]*segmentIndex{}
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		msg, n, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if last && (errors.Is(err, errTornRecord) || errors.Is(err, errCorruptRecord)) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("segment %s at offset %d: %w", path, offset, err)
+		}
+		s.addToIndex(seg, msg, offset)
+		offset += int64(n)
+	}
+	seg.size = offset
+	return file.Truncate(offset)
+}
+
+func (s *LogStore) segmentPath(id int, ext string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, ext))
+}
+
+func (s *LogStore) addToIndex(seg *segment, msg Message, offset int64) {
+	idx, ok := seg.index[msg.Publisher]
+	if !ok {
+		idx = &segmentIndex{Min: msg.Order, Max: msg.Order}
+		seg.index[msg.Publisher] = idx
+	}
+	if idx.Count%s.interval == 0 {
+		idx.Checkpoints = append(idx.Checkpoints, checkpoint{Offset: offset, Min: msg.Order, Max: msg.Order})
+	}
+	cp := &idx.Checkpoints[len(idx.Checkpoints)-1]
+	cp.Min = min(cp.Min, msg.Order)
+	cp.Max = max(cp.Max, msg.Order)
+	if msg.Timestamp.After(seg.newest) {
+		seg.newest = msg.Timestamp
+	}
+	idx.Min = min(idx.Min, msg.Order)
+	idx.Max = max(idx.Max, msg.Order)
+	idx.Count++
+}
+
+// rotate seals the active segment, writing its index alongside it,
+// and starts a new one.
+func (s *LogStore) rotate() error {
+	seg := s.segments[len(s.segments)-1]
+	if s.sync != SyncNever {
+		err := s.active.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	err := s.active.Close()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(storedIndex{Version: indexVersion, Size: seg.size, Newest: seg.newest, Index: seg.index})
+	if err != nil {
+		return err
+	}
+	err = WriteFileAtomic(s.segmentPath(seg.id, ".index"), data)
+	if err != nil {
+		return err
+	}
+	err = s.create(seg.id + 1)
+	if err != nil {
+		return err
+	}
+	return s.retain()
+}
+
+// storedIndex is the index file written alongside a sealed segment.
+type storedIndex struct {
+	Version int
+	Size    int64
+	Newest  time.Time
+	Index   map[string]*segmentIndex
+}
+
+// retain deletes the sealed segments the store's retention drops.
+func (s *LogStore) retain() error {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	now := s.now()
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		expired := s.retention.expired(oldest.newest, now)
+		oversize := s.retention.MaxBytes > 0 && total > int64(s.retention.MaxBytes)
+		if !expired && !oversize {
+			return nil
+		}
+		for _, ext := range []string{".log", ".index"} {
+			err := os.Remove(s.segmentPath(oldest.id, ext))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		total -= oldest.size
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// Save appends the messages to the active segment in a single write,
+// starting a new segment first if the active one is full or too old.
+func (s *LogStore) Save(m []Message) error {
+	var buf bytes.Buffer
+	offsets := make([]int64, len(m))
+	for i, msg := range m {
+		offsets[i] = int64(buf.Len())
+		err := writeRecord(&buf, msg)
+		if err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg := s.segments[len(s.segments)-1]
+	full := seg.size > 0 && seg.size+int64(buf.Len()) > s.maxSize
+	old := s.maxAge > 0 && s.now().Sub(seg.created) >= s.maxAge
+	if full || old {
+		err := s.rotate()
+		if err != nil {
+			return err
+		}
+		seg = s.segments[len(s.segments)-1]
+	}
+	_, err := s.active.WriteAt(buf.Bytes(), seg.size)
+	if err != nil {
+		return err
+	}
+	if s.sync == SyncEverySave {
+		err = s.active.Sync()
+		if err != nil {
+			return err
+		}
+	}
+	for i, msg := range m {
+		s.addToIndex(seg, msg, seg.size+offsets[i])
+	}
+	seg.size += int64(buf.Len())
+	s.waiters.notify(m)
+	return nil
+}
+
+// Notify returns a channel that is closed the next time a message
+// from the publisher is saved.
+func (s *LogStore) Notify(publisher string) <-chan struct{} {
+	return s.waiters.wait(publisher)
+}
+
+// Messages returns every message the publisher has saved.
+func (s *LogStore) Messages(publisher string) ([]Message, error) {
+	return s.Range(context.Background(), publisher, Range{})
+}
+
+// Range returns the publisher's messages selected by r. Only the sections
+// of segments whose index shows they may hold the selected orders are read.
+// With a Limit, sections are read from the end of the range the messages
+// are returned from, and reading stops once the rest can't be among them.
+func (s *LogStore) Range(ctx context.Context, publisher string, r Range) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := s.now()
+	sections := s.sections(publisher, r, now)
+	sort.SliceStable(sections, func(i, j int) bool {
+		if r.Reverse {
+			return sections[i].max > sections[j].max
+		}
+		return sections[i].min < sections[j].min
+	})
+	files := map[int]*os.File{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	found := map[int]located{}
+	for _, sec := range sections {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		if r.Limit > 0 && s.settled(found, sec, r, now) >= r.Limit {
+			break
+		}
+		file, ok := files[sec.segment]
+		if !ok {
+			file, err = os.Open(s.segmentPath(s.segments[sec.segment].id, ".log"))
+			if err != nil {
+				return nil, err
+			}
+			files[sec.segment] = file
+		}
+		err = s.readSection(file, sec, publisher, r, found)
+		if err != nil {
+			return nil, err
+		}
+	}
+	messages := make([]Message, 0, len(found))
+	for _, l := range found {
+		if !s.retention.expired(l.msg.Timestamp, now) {
+			messages = append(messages, l.msg)
+		}
+	}
+	return applyRange(messages, r), nil
+}
+
+// section is a run of a segment, from one of a publisher's checkpoints to
+// the next, and the lowest and highest orders of the publisher's records in it.
+type section struct {
+	segment    int
+	start, end int64
+	min, max   int
+}
+
+// located is a message found by a range read, and where its record is,
+// so that a later record of the same order replaces an earlier one.
+type located struct {
+	msg     Message
+	segment int
+	offset  int64
+}
+
+func (l located) after(other located) bool {
+	return l.segment > other.segment || (l.segment == other.segment && l.offset > other.offset)
+}
+
+// sections returns the sections of the publisher's records that may hold
+// orders selected by r, in the order they were written.
+func (s *LogStore) sections(publisher string, r Range, now time.Time) []section {
+	var sections []section
+	for i, seg := range s.segments {
+		idx, ok := seg.index[publisher]
+		if !ok || idx.Max < r.From || (r.To != 0 && idx.Min > r.To) {
+			continue
+		}
+		if s.retention.expired(seg.newest, now) {
+			continue
+		}
+		for j, cp := range idx.Checkpoints {
+			if cp.Max < r.From || (r.To != 0 && cp.Min > r.To) {
+				continue
+			}
+			end := seg.size
+			if j+1 < len(idx.Checkpoints) {
+				end = idx.Checkpoints[j+1].Offset
+			}
+			sections = append(sections, section{segment: i, start: cp.Offset, end: end, min: cp.Min, max: cp.Max})
+		}
+	}
+	return sections
+}
+
+// settled counts the messages found that no section from sec on can hold
+// or replace, because they come before it in the order r returns them.
+func (s *LogStore) settled(found map[int]located, sec section, r Range, now time.Time) int {
+	n := 0
+	for order, l := range found {
+		before := order < sec.min
+		if r.Reverse {
+			before = order > sec.max
+		}
+		if before && !s.retention.expired(l.msg.Timestamp, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// readSection adds the publisher's messages in the section selected by r
+// to found, replacing any found in records written before them.
+func (s *LogStore) readSection(file *os.File, sec section, publisher string, r Range, found map[int]located) error {
+	reader := bufio.NewReader(io.NewSectionReader(file, sec.start, sec.end-sec.start))
+	offset := sec.start
+	for {
+		msg, n, err := readRecord(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading segment %d: %w", s.segments[sec.segment].id, err)
+		}
+		at := located{msg: msg, segment: sec.segment, offset: offset}
+		offset += int64(n)
+		if msg.Publisher != publisher || msg.Order < r.From || (r.To != 0 && msg.Order > r.To) {
+			continue
+		}
+		if existing, ok := found[msg.Order]; ok && !at.after(existing) {
+			continue
+		}
+		found[msg.Order] = at
+	}
+}
+
+// Close syncs and closes the active segment. The LogStore can't be used afterwards.
+func (s *LogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sync != SyncNever {
+		err := s.active.Sync()
+		if err != nil {
+			s.active.Close()
+			return err
+		}
+	}
+	return s.active.Close()
+}
+
+var (
+	// errTornRecord is returned for a record that was not completely written.
+	errTornRecord = errors.New("torn record")
+	// errCorruptRecord is returned for a record that passes its checksum
+	// but doesn't hold a message.
+	errCorruptRecord = errors.New("corrupt record")
+)
+
+// writeRecord frames a message as its length, the CRC-32 of its JSON
+// encoding, and the encoding itself.
+func writeRecord(w io.Writer, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var header [recordHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+	_, err = w.Write(header[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// readRecord reads the next record and returns its message and length.
+// It returns io.EOF at a clean end, errTornRecord for a record that is
+// incomplete, empty or fails its checksum, and errCorruptRecord for one
+// that doesn't decode.
+func readRecord(r *bufio.Reader) (Message, int, error) {
+	var header [recordHeaderSize]byte
+	n, err := io.ReadFull(r, header[:])
+	if errors.Is(err, io.EOF) {
+		return Message{}, 0, io.EOF
+	}
+	if err != nil {
+		return Message{}, n, errTornRecord
+	}
+	length := binary.LittleEndian.Uint32(header[:4])
+	// A crash can extend the file before writing to it, leaving zeros whose
+	// empty payload would pass its checksum; no message encodes to nothing.
+	if length == 0 || length > maxRecordSize {
+		return Message{}, n, errTornRecord
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return Message{}, n, errTornRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+		return Message{}, n, errTornRecord
+	}
+	var msg Message
+	err = json.Unmarshal(payload, &msg)
+	if err != nil {
+		return Message{}, n, fmt.Errorf("%w: %w", errCorruptRecord, err)
+	}
+	return msg, recordHeaderSize + int(length), nil
+}
@@ -0,0 +1,298 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+var _ store.Store = (*store.LogStore)(nil)
+var _ store.Notifier = (*store.LogStore)(nil)
+
+func TestLogStore_RotatesSegmentsBySizeAndReadsAcrossThemAfterReopening(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	s := helperLogStore(t, dir, store.WithSegmentSize(512), store.WithIndexInterval(2))
+	for _, m := range helperMessages("p1", 40) {
+		err := s.Save([]store.Message{m})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segments := helperSegments(t, dir); segments < 3 {
+		t.Errorf("want at least 3 segments, got %d", segments)
+	}
+	reopened := helperLogStore(t, dir, store.WithSegmentSize(512), store.WithIndexInterval(2))
+	messages, err := reopened.Range(context.Background(), "p1", store.Range{From: 15, To: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25}
+	if !cmp.Equal(want, orders(messages)) {
+		t.Error(cmp.Diff(want, orders(messages)))
+	}
+}
+
+func TestLogStore_RangeFindsMessagesSavedOutOfOrder(t *testing.T) {
+	t.Parallel()
+	s := helperLogStore(t, t.TempDir(), store.WithIndexInterval(1))
+	saves := [][]store.Message{
+		helperMessages("p1", 20)[10:],
+		helperMessages("p2", 5),
+		helperMessages("p1", 10),
+	}
+	for _, m := range saves {
+		err := s.Save(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := s.Range(context.Background(), "p1", store.Range{From: 8, To: 13, Reverse: true, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{13, 12, 11, 10, 9}
+	if !cmp.Equal(want, orders(messages)) {
+		t.Error(cmp.Diff(want, orders(messages)))
+	}
+}
+
+func TestLogStore_RangeReadsOnlyTheSectionsItNeeds(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	s := helperLogStore(t, dir, store.WithSegmentSize(512), store.WithIndexInterval(2))
+	for _, m := range helperMessages("p1", 40) {
+		err := s.Save([]store.Message{m})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	// Garble the first segment, so that any read of it fails.
+	segments, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(segments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(segments[0], make([]byte, info.Size()), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened := helperLogStore(t, dir, store.WithSegmentSize(512), store.WithIndexInterval(2))
+	tests := map[string]struct {
+		r    store.Range
+		want []int
+	}{
+		"newest first with a limit": {store.Range{Limit: 3, Reverse: true}, []int{40, 39, 38}},
+		"a bounded range":           {store.Range{From: 30, To: 33}, []int{30, 31, 32, 33}},
+	}
+	for name, tc := range tests {
+		messages, err := reopened.Range(context.Background(), "p1", tc.r)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !cmp.Equal(tc.want, orders(messages)) {
+			t.Errorf("%s: %s", name, cmp.Diff(tc.want, orders(messages)))
+		}
+	}
+}
+
+func TestLogStore_LaterSaveReplacesAMessageInAnEarlierSegment(t *testing.T) {
+	t.Parallel()
+	s := helperLogStore(t, t.TempDir(), store.WithSegmentSize(1))
+	err := s.Save([]store.Message{{Publisher: "p1", Order: 1, Content: "first"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save([]store.Message{{Publisher: "p1", Order: 1, Content: "second"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "second" {
+		t.Errorf("want only the second message, got %v", messages)
+	}
+}
+
+func TestLogStore_RotatesSegmentsByAge(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	s := helperLogStore(t, dir, store.WithSegmentAge(time.Hour), store.WithLogClock(func() time.Time { return now }))
+	for i, m := range helperMessages("p1", 3) {
+		now = now.Add(time.Duration(i) * time.Hour)
+		err := s.Save([]store.Message{m})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if segments := helperSegments(t, dir); segments != 3 {
+		t.Errorf("want 3 segments, got %d", segments)
+	}
+}
+
+func TestLogStore_TruncatesTornTailRecordOnReopen(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	s := helperLogStore(t, dir, store.WithSyncPolicy(store.SyncOnRotate))
+	err := s.Save(helperMessages("p1", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	segments, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte{40, 0, 0, 0, 1, 2, 3, 4, '{', '"'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	reopened := helperLogStore(t, dir)
+	err = reopened.Save([]store.Message{{Publisher: "p1", Order: 4, Content: "a line"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+	messages, err := helperLogStore(t, dir).Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(helperMessages("p1", 4), messages) {
+		t.Error(cmp.Diff(helperMessages("p1", 4), messages))
+	}
+}
+
+func TestLogStore_TruncatesZeroFilledTailOnReopen(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	s := helperLogStore(t, dir)
+	err := s.Save(helperMessages("p1", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	segments, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A crash can leave the file extended but the data never written.
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write(make([]byte, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	reopened := helperLogStore(t, dir)
+	err = reopened.Save([]store.Message{{Publisher: "p1", Order: 4, Content: "a line"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+	messages, err := helperLogStore(t, dir).Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(helperMessages("p1", 4), messages) {
+		t.Error(cmp.Diff(helperMessages("p1", 4), messages))
+	}
+}
+
+func TestLogStore_RetentionDeletesOldestSegmentsBeyondMaxBytes(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	s := helperLogStore(t, dir, store.WithSegmentSize(256), store.WithLogRetention(store.Retention{MaxBytes: 1024}))
+	for _, m := range helperMessages("p1", 100) {
+		err := s.Save([]store.Message{m})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if segments := helperSegments(t, dir); segments > 6 {
+		t.Errorf("want at most 6 segments retained, got %d", segments)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Order != 100 || messages[0].Order == 1 {
+		t.Errorf("want only the newest messages retained, got orders %v", orders(messages))
+	}
+}
+
+func TestLogStore_RetentionDeletesSegmentsOnceEveryMessageHasExpired(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	s := helperLogStore(t, dir, store.WithSegmentSize(1), store.WithLogClock(clock), store.WithLogRetention(store.Retention{MaxAge: time.Hour}))
+	for i := 1; i <= 3; i++ {
+		if i > 1 {
+			now = now.Add(time.Hour)
+		}
+		err := s.Save([]store.Message{{Publisher: "p1", Order: i, Timestamp: now}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{2, 3}, orders(messages)) {
+		t.Error(cmp.Diff([]int{2, 3}, orders(messages)))
+	}
+	if segments := helperSegments(t, dir); segments != 2 {
+		t.Errorf("want 2 segments retained, got %d", segments)
+	}
+}
+
+func TestLogStore_RefusesToLimitNumberOfMessages(t *testing.T) {
+	t.Parallel()
+	_, err := store.NewLogStore(t.TempDir(), store.WithLogRetention(store.Retention{MaxMessages: 10}))
+	if err == nil {
+		t.Error("want an error limiting the number of messages in a log store")
+	}
+}
+
+func helperLogStore(t *testing.T, dir string, opts ...store.LogStoreOptions) *store.LogStore {
+	t.Helper()
+	s, err := store.NewLogStore(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func helperSegments(t *testing.T, dir string) int {
+	t.Helper()
+	segments, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(segments)
+}
@@ -1,44 +1,204 @@
 package store
 
 import (
+	"context"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 )
 
+// MemoryStore is a [Store] that keeps messages in memory, sorted by Order.
+// Each publisher's messages are locked separately, so that subscribers
+// saving different publishers' messages don't contend with each other.
+// Saving a message whose Publisher and Order are already stored replaces it.
 type MemoryStore struct {
-	syncMap sync.Map
+	mu        sync.RWMutex
+	ledgers   map[string]*ledger
+	retention Retention
+	waiters   waiters
+	now       func() time.Time
 }
+
+// Ledger is a publisher's messages, keyed by Order, as the MemoryStore
+// once kept them.
+//
+// Deprecated: MemoryStore no longer uses Ledger; read a publisher's
+// messages with [MemoryStore.Messages] or [MemoryStore.Range] instead.
 type Ledger map[int]string
 
-func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
-		syncMap: sync.Map{},
+// ledger is one publisher's messages, sorted by Order.
+type ledger struct {
+	mu       sync.RWMutex
+	messages []Message
+}
+
+// MemoryStoreOptions are functional options for configuring a [MemoryStore].
+type MemoryStoreOptions func(*MemoryStore)
+
+// WithCapacity is a functional option bounding how many messages a
+// [MemoryStore] keeps for each publisher. Once a publisher has more, its
+// lowest orders are evicted. By default a MemoryStore is unbounded.
+// It is shorthand for a [Retention] with only MaxMessages set.
+func WithCapacity(n int) MemoryStoreOptions {
+	return func(s *MemoryStore) {
+		s.retention.MaxMessages = n
+	}
+}
+
+// WithMemoryRetention is a functional option specifying the [Retention] a
+// [MemoryStore] enforces. Messages beyond it are evicted when their
+// publisher next saves, and expired messages are never returned.
+func WithMemoryRetention(r Retention) MemoryStoreOptions {
+	return func(s *MemoryStore) {
+		s.retention = r
+	}
+}
+
+func NewMemoryStore(opts ...MemoryStoreOptions) *MemoryStore {
+	s := &MemoryStore{
+		ledgers: map[string]*ledger{},
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
+// ledger returns the publisher's ledger, creating it if create is set.
+func (s *MemoryStore) ledger(publisher string, create bool) *ledger {
+	s.mu.RLock()
+	l, ok := s.ledgers[publisher]
+	s.mu.RUnlock()
+	if ok || !create {
+		return l
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ledgers == nil {
+		s.ledgers = map[string]*ledger{}
+	}
+	l, ok = s.ledgers[publisher]
+	if !ok {
+		l = &ledger{}
+		s.ledgers[publisher] = l
+	}
+	return l
+}
+
+// Save inserts the messages in order, evicting any of each publisher's
+// messages beyond the store's retention, then wakes anyone waiting on them.
 func (s *MemoryStore) Save(m []Message) error {
 	for _, msg := range m {
-		p, ok := s.syncMap.Load(msg.Publisher)
-		if !ok {
-			s.syncMap.Store(msg.Publisher, Ledger{msg.Order: msg.Content})
-		} else {
-			p.(Ledger)[msg.Order] = msg.Content
+		l := s.ledger(msg.Publisher, true)
+		l.mu.Lock()
+		l.insert(msg)
+		l.mu.Unlock()
+	}
+	if s.retention != (Retention{}) {
+		for _, l := range s.touched(m) {
+			l.mu.Lock()
+			l.retain(s.retention, s.clock())
+			l.mu.Unlock()
 		}
 	}
+	s.waiters.notify(m)
 	return nil
 }
 
+// touched returns the ledgers of the publishers of the messages.
+func (s *MemoryStore) touched(m []Message) []*ledger {
+	var ledgers []*ledger
+	seen := map[string]bool{}
+	for _, msg := range m {
+		if !seen[msg.Publisher] {
+			seen[msg.Publisher] = true
+			ledgers = append(ledgers, s.ledger(msg.Publisher, false))
+		}
+	}
+	return ledgers
+}
+
+// retain evicts the messages r drops from the ledger.
+func (l *ledger) retain(r Retention, now time.Time) {
+	entries := make([]retained, len(l.messages))
+	for i, msg := range l.messages {
+		entries[i] = retained{Order: msg.Order, Timestamp: msg.Timestamp, Size: len(msg.Content)}
+	}
+	evicted := map[int]bool{}
+	for _, order := range r.evict(entries, now) {
+		evicted[order] = true
+	}
+	if len(evicted) > 0 {
+		l.messages = slices.DeleteFunc(l.messages, func(msg Message) bool {
+			return evicted[msg.Order]
+		})
+	}
+}
+
+func (l *ledger) insert(msg Message) {
+	i, found := slices.BinarySearchFunc(l.messages, msg.Order, func(m Message, order int) int {
+		return m.Order - order
+	})
+	if found {
+		l.messages[i] = msg
+		return
+	}
+	l.messages = slices.Insert(l.messages, i, msg)
+}
+
+// clock returns the current time, from [time.Now] unless the store was given another clock.
+func (s *MemoryStore) clock() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
+// Notify returns a channel that is closed the next time a message
+// from the publisher is saved.
+func (s *MemoryStore) Notify(publisher string) <-chan struct{} {
+	return s.waiters.wait(publisher)
+}
+
+// Messages returns every message the publisher has saved, sorted by Order.
 func (s *MemoryStore) Messages(publisher string) ([]Message, error) {
-	var m []Message
-	messages, ok := s.syncMap.Load(publisher)
-	if !ok {
+	return s.Range(context.Background(), publisher, Range{})
+}
+
+// Range returns the publisher's messages selected by r.
+func (s *MemoryStore) Range(_ context.Context, publisher string, r Range) ([]Message, error) {
+	l := s.ledger(publisher, false)
+	if l == nil {
 		return []Message{}, nil
 	}
-	for k, v := range messages.(Ledger) {
-		m = append(m, Message{
-			Publisher: publisher,
-			Order:     k,
-			Content:   v,
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	from := sort.Search(len(l.messages), func(i int) bool {
+		return l.messages[i].Order >= r.From
+	})
+	to := len(l.messages)
+	if r.To != 0 {
+		to = sort.Search(len(l.messages), func(i int) bool {
+			return l.messages[i].Order > r.To
 		})
 	}
-	return m, nil
+	if to < from {
+		return []Message{}, nil
+	}
+	selected := slices.Clone(l.messages[from:to])
+	if s.retention.MaxAge > 0 {
+		now := s.clock()
+		selected = slices.DeleteFunc(selected, func(msg Message) bool {
+			return s.retention.expired(msg.Timestamp, now)
+		})
+	}
+	if r.Reverse {
+		slices.Reverse(selected)
+	}
+	if r.Limit > 0 && len(selected) > r.Limit {
+		selected = selected[:r.Limit]
+	}
+	return selected, nil
 }
@@ -0,0 +1,37 @@
+package store
+
+import "sync"
+
+// waiters tracks the channels handed out by a store's Notify method,
+// one per publisher, each closed on the publisher's next Save.
+type waiters struct {
+	mu       sync.Mutex
+	channels map[string]chan struct{}
+}
+
+// wait returns the channel closed on the publisher's next Save.
+func (w *waiters) wait(publisher string) <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.channels == nil {
+		w.channels = map[string]chan struct{}{}
+	}
+	c, ok := w.channels[publisher]
+	if !ok {
+		c = make(chan struct{})
+		w.channels[publisher] = c
+	}
+	return c
+}
+
+// notify wakes everyone waiting on the publishers of the saved messages.
+func (w *waiters) notify(m []Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, msg := range m {
+		if c, ok := w.channels[msg.Publisher]; ok {
+			close(c)
+			delete(w.channels, msg.Publisher)
+		}
+	}
+}
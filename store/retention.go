@@ -0,0 +1,55 @@
+package store
+
+import "time"
+
+// Retention bounds how much of each publisher's stream a store keeps, so
+// that log-like streams don't grow forever. Messages beyond a bound are
+// dropped oldest first, by Order. A zero field leaves that dimension unbounded.
+type Retention struct {
+	// MaxAge is how long a message is kept after its Timestamp.
+	// Messages without a Timestamp never age out.
+	MaxAge time.Duration
+	// MaxMessages is how many of a publisher's messages are kept.
+	MaxMessages int
+	// MaxBytes bounds the total size of the Content of a publisher's
+	// messages.
+	MaxBytes int
+}
+
+// retained is what a Retention needs to know about a stored message.
+type retained struct {
+	Order     int
+	Timestamp time.Time
+	Size      int
+}
+
+// expired reports whether a message with the given timestamp is older than MaxAge.
+func (r Retention) expired(timestamp time.Time, now time.Time) bool {
+	return r.MaxAge > 0 && !timestamp.IsZero() && now.Sub(timestamp) > r.MaxAge
+}
+
+// limited reports whether r bounds the number or size of messages.
+func (r Retention) limited() bool {
+	return r.MaxMessages > 0 || r.MaxBytes > 0
+}
+
+// evict returns the orders of the messages r drops from a publisher's
+// stream, given its messages sorted by Order.
+func (r Retention) evict(messages []retained, now time.Time) []int {
+	var evicted []int
+	var count, size int
+	full := false
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		full = full ||
+			(r.MaxMessages > 0 && count+1 > r.MaxMessages) ||
+			(r.MaxBytes > 0 && size+m.Size > r.MaxBytes)
+		if full || r.expired(m.Timestamp, now) {
+			evicted = append(evicted, m.Order)
+			continue
+		}
+		count++
+		size += m.Size
+	}
+	return evicted
+}
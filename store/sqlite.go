@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// Registers the pure-Go "sqlite" driver, so that no cgo is needed.
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore is a [Store] that keeps messages in a SQLite database, for
+// running subscribers on a single box without DynamoDB. Messages are keyed
+// by Publisher and Order, and saving a message whose key is already stored
+// replaces it, so that redelivered messages are saved idempotently.
+//
+// The database schema is migrated to the latest version when the store is opened.
+type SQLiteStore struct {
+	db      *sql.DB
+	waiters waiters
+}
+
+// sqliteMigrations are the statements that bring the database schema from
+// each version to the next. The version is kept in PRAGMA user_version,
+// and is the number of migrations applied. New migrations are only ever
+// appended.
+var sqliteMigrations = []string{
+	`CREATE TABLE messages (
+		publisher TEXT NOT NULL,
+		"order" INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		id TEXT NOT NULL DEFAULT '',
+		timestamp TEXT NOT NULL DEFAULT '',
+		headers TEXT,
+		PRIMARY KEY (publisher, "order")
+	) WITHOUT ROWID`,
+}
+
+// NewSQLiteStore opens the SQLiteStore in the database file at path,
+// creating it if it doesn't exist, and migrates its schema.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serialises writers, so that saves never fail
+	// with SQLITE_BUSY, and lets an in-memory database be shared.
+	db.SetMaxOpenConns(1)
+	s := &SQLiteStore{db: db}
+	err = s.migrate(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// migrate applies every migration the database hasn't had yet, each in its
+// own transaction along with the version bump.
+func (s *SQLiteStore) migrate(ctx context.Context) error {
+	var version int
+	err := s.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("schema version %d is newer than this version of rivulet supports (%d)", version, len(sqliteMigrations))
+	}
+	for v := version; v < len(sqliteMigrations); v++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, sqliteMigrations[v])
+		if err == nil {
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", v+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save upserts the messages in a single transaction.
+func (s *SQLiteStore) Save(m []Message) error {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO messages (publisher, "order", content, id, timestamp, headers)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (publisher, "order") DO UPDATE SET
+			content = excluded.content,
+			id = excluded.id,
+			timestamp = excluded.timestamp,
+			headers = excluded.headers`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, msg := range m {
+		var timestamp string
+		if !msg.Timestamp.IsZero() {
+			timestamp = msg.Timestamp.Format(time.RFC3339Nano)
+		}
+		var headers sql.NullString
+		if len(msg.Headers) > 0 {
+			data, err := json.Marshal(msg.Headers)
+			if err != nil {
+				return err
+			}
+			headers = sql.NullString{String: string(data), Valid: true}
+		}
+		_, err = stmt.ExecContext(ctx, msg.Publisher, msg.Order, msg.Content, msg.ID, timestamp, headers)
+		if err != nil {
+			return fmt.Errorf("saving message %d from %s: %w", msg.Order, msg.Publisher, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	s.waiters.notify(m)
+	return nil
+}
+
+// Notify returns a channel that is closed the next time a message
+// from the publisher is saved through this store.
+func (s *SQLiteStore) Notify(publisher string) <-chan struct{} {
+	return s.waiters.wait(publisher)
+}
+
+// Messages returns every message the publisher has saved.
+func (s *SQLiteStore) Messages(publisher string) ([]Message, error) {
+	return s.Range(context.Background(), publisher, Range{})
+}
+
+// Range returns the publisher's messages selected by r, using the
+// primary key to select the orders.
+func (s *SQLiteStore) Range(ctx context.Context, publisher string, r Range) ([]Message, error) {
+	var query strings.Builder
+	query.WriteString(`SELECT publisher, "order", content, id, timestamp, headers FROM messages WHERE publisher = ? AND "order" >= ?`)
+	args := []any{publisher, r.From}
+	if r.To != 0 {
+		query.WriteString(` AND "order" <= ?`)
+		args = append(args, r.To)
+	}
+	if r.Reverse {
+		query.WriteString(` ORDER BY "order" DESC`)
+	} else {
+		query.WriteString(` ORDER BY "order" ASC`)
+	}
+	if r.Limit > 0 {
+		query.WriteString(` LIMIT ?`)
+		args = append(args, r.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		var timestamp string
+		var headers sql.NullString
+		err = rows.Scan(&msg.Publisher, &msg.Order, &msg.Content, &msg.ID, &timestamp, &headers)
+		if err != nil {
+			return nil, err
+		}
+		if timestamp != "" {
+			msg.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp)
+			if err != nil {
+				return nil, fmt.Errorf("message %d from %s has invalid timestamp: %w", msg.Order, msg.Publisher, err)
+			}
+		}
+		if headers.Valid {
+			err = json.Unmarshal([]byte(headers.String), &msg.Headers)
+			if err != nil {
+				return nil, fmt.Errorf("message %d from %s has invalid headers: %w", msg.Order, msg.Publisher, err)
+			}
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// Close closes the database. The SQLiteStore can't be used afterwards.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
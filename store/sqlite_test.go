@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+var _ store.Store = (*store.SQLiteStore)(nil)
+
+func TestSQLiteStore_RoundTripsMessagesWithMetadataAcrossReopening(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "rivulet.db")
+	s := helperSQLiteStore(t, path)
+	want := []store.Message{
+		{Publisher: "p1", Order: 1, Content: "a line", ID: "id", Timestamp: time.Date(2024, 5, 1, 0, 0, 0, 1, time.UTC), Headers: map[string]string{"k": "v"}},
+		{Publisher: "p1", Order: 2, Content: "another line"},
+	}
+	err := s.Save(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	got, err := helperSQLiteStore(t, path).Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestSQLiteStore_SavingAnOrderAgainUpsertsIt(t *testing.T) {
+	t.Parallel()
+	s := helperSQLiteStore(t, filepath.Join(t.TempDir(), "rivulet.db"))
+	for _, content := range []string{"first", "second", "second"} {
+		err := s.Save([]store.Message{{Publisher: "p1", Order: 1, Content: content}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Content != "second" {
+		t.Errorf("want only the second message, got %v", messages)
+	}
+}
+
+func TestSQLiteStore_RangeSelectsOrdersInSequence(t *testing.T) {
+	t.Parallel()
+	s := helperSQLiteStore(t, filepath.Join(t.TempDir(), "rivulet.db"))
+	err := s.Save(append(helperMessages("p1", 10), helperMessages("p2", 10)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]struct {
+		r    store.Range
+		want []int
+	}{
+		"bounded":   {store.Range{From: 3, To: 5}, []int{3, 4, 5}},
+		"unbounded": {store.Range{From: 8}, []int{8, 9, 10}},
+		"reversed":  {store.Range{To: 9, Limit: 2, Reverse: true}, []int{9, 8}},
+	}
+	for name, tc := range cases {
+		messages, err := s.Range(context.Background(), "p1", tc.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(tc.want, orders(messages)) {
+			t.Errorf("%s: %s", name, cmp.Diff(tc.want, orders(messages)))
+		}
+	}
+}
+
+func TestSQLiteStore_MigratesSchemaOnlyOnce(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "rivulet.db")
+	helperSQLiteStore(t, path).Close()
+	helperSQLiteStore(t, path).Close()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var version int
+	err = db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("want schema version 1, got %d", version)
+	}
+}
+
+func helperSQLiteStore(t *testing.T, path string) *store.SQLiteStore {
+	t.Helper()
+	s, err := store.NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
@@ -1,12 +1,147 @@
+// Package store persists the messages a subscriber receives. The stores
+// backed by local files, [FileStore] and [LogStore], index the files in
+// memory, so each must only be opened by one process at a time.
 package store
 
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
 type Message struct {
 	Publisher string
 	Order     int
 	Content   string
+	ID        string
+	Timestamp time.Time
+	Headers   map[string]string `json:",omitempty"`
 }
 type Store interface {
 	// Will be a []Message
 	Save([]Message) error
 	Messages(string) ([]Message, error)
+	// Range returns the publisher's messages selected by the [Range],
+	// sorted by Order.
+	Range(ctx context.Context, publisher string, r Range) ([]Message, error)
+}
+
+// Notifier is implemented by a [Store] that can announce new messages,
+// so that readers following a stream can wait for them instead of polling.
+type Notifier interface {
+	// Notify returns a channel that is closed the next time a message
+	// from the publisher is saved.
+	Notify(publisher string) <-chan struct{}
+}
+
+// Range selects part of a publisher's stream by Order.
+// The zero Range selects every message, oldest first.
+type Range struct {
+	// From is the lowest Order included. Zero means from the start.
+	From int
+	// To is the highest Order included. Zero means no upper bound.
+	To int
+	// Limit is the most messages returned. Zero means no limit.
+	Limit int
+	// Reverse returns the newest messages first.
+	Reverse bool
+}
+
+// After returns a Range selecting every message after the cursor order,
+// for resuming a read where an earlier one stopped.
+func After(order int) Range {
+	return Range{From: order + 1}
+}
+
+// Pages reads the messages selected by r in pages of at most size messages,
+// calling fn with each page in turn. It stops when the messages run out, when
+// r.Limit messages have been read, or when fn returns an error, which Pages
+// then returns. Each page is a separate call to the store's Range, so a large
+// stream never has to be held in memory at once.
+func Pages(ctx context.Context, s Store, publisher string, r Range, size int, fn func([]Message) error) error {
+	remaining := r.Limit
+	for {
+		page := r
+		page.Limit = size
+		if remaining > 0 && (size <= 0 || remaining < size) {
+			page.Limit = remaining
+		}
+		messages, err := s.Range(ctx, publisher, page)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		err = fn(messages)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			remaining -= len(messages)
+			if remaining <= 0 {
+				return nil
+			}
+		}
+		if page.Limit <= 0 || len(messages) < page.Limit {
+			return nil
+		}
+		last := messages[len(messages)-1].Order
+		if r.Reverse {
+			// A To of zero means no upper bound, so a reverse page can't
+			// end at order zero; paging stops before reaching it.
+			if last-1 < max(r.From, 1) {
+				return nil
+			}
+			r.To = last - 1
+		} else {
+			r.From = last + 1
+		}
+	}
+}
+
+// applyRange sorts messages by Order and returns those selected by r.
+// It is for stores that can't select a range natively.
+func applyRange(messages []Message, r Range) []Message {
+	sort.Slice(messages, func(i, j int) bool {
+		if r.Reverse {
+			return messages[i].Order > messages[j].Order
+		}
+		return messages[i].Order < messages[j].Order
+	})
+	var selected []Message
+	for _, msg := range messages {
+		if msg.Order < r.From || (r.To != 0 && msg.Order > r.To) {
+			continue
+		}
+		selected = append(selected, msg)
+		if r.Limit > 0 && len(selected) == r.Limit {
+			break
+		}
+	}
+	return selected
+}
+
+// WriteFileAtomic replaces the file at path with data by writing a
+// temporary file alongside it and renaming it into place, so that a crash
+// mid-write never leaves a torn file behind.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
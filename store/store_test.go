@@ -0,0 +1,234 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mr-joshcrane/rivulet/store"
+)
+
+func TestMemoryStore_RangeSelectsOrdersInSequence(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(helperMessages("p1", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]struct {
+		r    store.Range
+		want []int
+	}{
+		"everything":      {store.Range{}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		"between":         {store.Range{From: 3, To: 5}, []int{3, 4, 5}},
+		"after cursor":    {store.After(8), []int{9, 10}},
+		"limited":         {store.Range{Limit: 2}, []int{1, 2}},
+		"newest first":    {store.Range{Reverse: true, Limit: 3}, []int{10, 9, 8}},
+		"reversed window": {store.Range{From: 2, To: 4, Reverse: true}, []int{4, 3, 2}},
+	}
+	for name, tc := range cases {
+		messages, err := s.Range(context.Background(), "p1", tc.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := orders(messages)
+		if !cmp.Equal(tc.want, got) {
+			t.Errorf("%s: %s", name, cmp.Diff(tc.want, got))
+		}
+	}
+}
+
+func TestMemoryStore_NotifyFiresOnlyForThePublishersNextSave(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	notify := s.Notify("p1")
+	err := s.Save(helperMessages("p2", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-notify:
+		t.Fatal("notified of another publisher's save")
+	default:
+	}
+	err = s.Save(helperMessages("p1", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-notify:
+	default:
+		t.Fatal("not notified of the publisher's save")
+	}
+}
+
+func TestMemoryStore_MessagesAreSortedByOrder(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	for _, order := range []int{5, 2, 9, 1, 7} {
+		err := s.Save([]store.Message{{Publisher: "p1", Order: order}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{1, 2, 5, 7, 9}, orders(messages)) {
+		t.Error(cmp.Diff([]int{1, 2, 5, 7, 9}, orders(messages)))
+	}
+}
+
+func TestMemoryStore_ZeroValueIsReadyToUse(t *testing.T) {
+	t.Parallel()
+	var s store.MemoryStore
+	notify := s.Notify("p1")
+	err := s.Save([]store.Message{{Publisher: "p1", Order: 2}, {Publisher: "p1", Order: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-notify:
+	default:
+		t.Fatal("not notified of the publisher's save")
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{1, 2}, orders(messages)) {
+		t.Error(cmp.Diff([]int{1, 2}, orders(messages)))
+	}
+}
+
+func TestMemoryStore_IsSafeForConcurrentSavesAndReads(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		publisher := fmt.Sprintf("p%d", p%2)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 100; i++ {
+				err := s.Save([]store.Message{{Publisher: publisher, Order: i}})
+				if err != nil {
+					t.Error(err)
+				}
+				_, err = s.Messages(publisher)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, publisher := range []string{"p0", "p1"} {
+		messages, err := s.Messages(publisher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != 100 {
+			t.Errorf("want 100 messages from %s, got %d", publisher, len(messages))
+		}
+	}
+}
+
+func TestMemoryStore_EvictsLowestOrdersBeyondCapacity(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore(store.WithCapacity(3))
+	err := s.Save(append(helperMessages("p1", 5), helperMessages("p2", 2)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{3, 4, 5}, orders(messages)) {
+		t.Error(cmp.Diff([]int{3, 4, 5}, orders(messages)))
+	}
+	messages, err = s.Messages("p2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{1, 2}, orders(messages)) {
+		t.Error(cmp.Diff([]int{1, 2}, orders(messages)))
+	}
+}
+
+func TestMemoryStore_RetentionEvictsOldestMessagesBeyondAnyBound(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	s := store.NewMemoryStore(store.WithMemoryRetention(store.Retention{MaxAge: time.Hour, MaxBytes: 10}))
+	err := s.Save([]store.Message{
+		{Publisher: "p1", Order: 1, Content: "old", Timestamp: now.Add(-2 * time.Hour)},
+		{Publisher: "p1", Order: 2, Content: "1234", Timestamp: now},
+		{Publisher: "p1", Order: 3, Content: "12345", Timestamp: now},
+		{Publisher: "p1", Order: 4, Content: "123", Timestamp: now},
+		{Publisher: "p1", Order: 5, Content: "1", Timestamp: now},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := s.Messages("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]int{3, 4, 5}, orders(messages)) {
+		t.Error(cmp.Diff([]int{3, 4, 5}, orders(messages)))
+	}
+}
+
+func TestPages_ReadsRangeIncrementally(t *testing.T) {
+	t.Parallel()
+	s := store.NewMemoryStore()
+	err := s.Save(helperMessages("p1", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages [][]int
+	err = store.Pages(context.Background(), s, "p1", store.Range{From: 2}, 4, func(m []store.Message) error {
+		pages = append(pages, orders(m))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]int{{2, 3, 4, 5}, {6, 7, 8, 9}, {10}}
+	if !cmp.Equal(want, pages) {
+		t.Error(cmp.Diff(want, pages))
+	}
+	pages = nil
+	err = store.Pages(context.Background(), s, "p1", store.Range{Reverse: true, Limit: 5}, 2, func(m []store.Message) error {
+		pages = append(pages, orders(m))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = [][]int{{10, 9}, {8, 7}, {6}}
+	if !cmp.Equal(want, pages) {
+		t.Error(cmp.Diff(want, pages))
+	}
+}
+
+func helperMessages(publisher string, n int) []store.Message {
+	var messages []store.Message
+	for i := 1; i <= n; i++ {
+		messages = append(messages, store.Message{Publisher: publisher, Order: i, Content: "a line"})
+	}
+	return messages
+}
+
+func orders(messages []store.Message) []int {
+	var o []int
+	for _, m := range messages {
+		o = append(o, m.Order)
+	}
+	return o
+}
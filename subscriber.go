@@ -1,7 +1,14 @@
 package rivulet
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/mr-joshcrane/rivulet/store"
@@ -9,9 +16,49 @@ import (
 
 // Subscriber is a consumer of messages. It expects to receive messages
 // from its [Receiver] and save them to its [Store].
+// Messages are also passed to any [Handler] registered with Handle.
 type Subscriber struct {
 	receiver Receiver
 	Store    store.Store
+
+	handlers     []Handler
+	onError      func(Message, error)
+	filter       *Pattern
+	DrainTimeout time.Duration
+}
+
+// Handler processes a single message received by a [Subscriber].
+type Handler func(context.Context, Message) error
+
+// DefaultDrainTimeout is how long [Subscriber.Run] waits for messages still
+// buffered in its [Receiver] once it has been asked to stop.
+const DefaultDrainTimeout = time.Second
+
+// Handle registers a [Handler] to be called with every message the Subscriber
+// receives, after the message has been saved to the [Store].
+// Handlers are called one at a time, in the order they were registered,
+// and must be registered before the Subscriber starts receiving.
+func (s *Subscriber) Handle(h Handler) {
+	s.handlers = append(s.handlers, h)
+}
+
+// OnError registers a function to be told about each message a [Handler]
+// failed to process. Without one, the first handler error stops the Subscriber.
+func (s *Subscriber) OnError(f func(Message, error)) {
+	s.onError = f
+}
+
+// Filter makes the Subscriber drop every message that doesn't match the
+// event pattern, neither saving it nor handing it to any [Handler].
+// Messages are matched as the events an [EventBridgeTransport] with its
+// default options would send for them; see [Pattern.MatchMessage].
+//
+// The orders of dropped messages are never stored, so a filtered stream
+// has gaps a [Reader] waits on until its reorder timeout passes. Read a
+// filtered store with [Read] or [store.Store.Range], which don't look for
+// gaps, or give its Readers a short timeout with [WithReorderWindow].
+func (s *Subscriber) Filter(p *Pattern) {
+	s.filter = p
 }
 
 // Receiver is a mechanism for receiving messages.
@@ -19,6 +66,13 @@ type Receiver interface {
 	Receive(context.Context) ([]Message, error)
 }
 
+// Drainer is a [Receiver] that can hand over the messages it already holds
+// without waiting for more, so that a [Subscriber] shutting down doesn't
+// wait out its DrainTimeout when nothing is buffered.
+type Drainer interface {
+	Drain() ([]Message, error)
+}
+
 // InMemoryReceiver is a Receiver that receives messages from an InMemoryTransport
 type InMemoryReceiver struct {
 	messages <-chan Message
@@ -29,16 +83,162 @@ type InMemoryReceiver struct {
 // Ideally signal the context when you're done receiving messages, rather than
 // closing the channel.
 func (r *InMemoryReceiver) Receive(ctx context.Context) ([]Message, error) {
+	return receiveAvailable(ctx, r.messages)
+}
+
+// Drain returns the messages already buffered, without waiting for more.
+func (r *InMemoryReceiver) Drain() ([]Message, error) {
+	return drainAvailable(r.messages, nil), nil
+}
+
+// NetworkReceiver is a Receiver that receives messages sent by a [NetworkTransport].
+// It is an [http.Handler]; mount it on a server at the endpoint the
+// NetworkTransport publishes to. Accepted messages are buffered until
+// they are collected by Receive.
+type NetworkReceiver struct {
+	messages chan Message
+}
+
+// maxNetworkMessageBytes bounds the size of a single request body accepted by a NetworkReceiver.
+const maxNetworkMessageBytes = 1 << 20
+
+// NewNetworkReceiver creates a [NetworkReceiver] ready to be served over HTTP.
+func NewNetworkReceiver() *NetworkReceiver {
+	return &NetworkReceiver{messages: make(chan Message, 1_000)}
+}
+
+// NewNetworkSubscriber creates a [Subscriber] that saves messages received by
+// the given [NetworkReceiver] to the given [store.Store].
+func NewNetworkSubscriber(receiver *NetworkReceiver, store store.Store) *Subscriber {
+	return &Subscriber{
+		receiver: receiver,
+		Store:    store,
+	}
+}
+
+// ServeHTTP accepts a JSON encoded [Message], or a JSON array of them, POSTed by
+// a [NetworkTransport]. A malformed or invalid single message is rejected with
+// 400 Bad Request, and 503 Service Unavailable is returned if the buffer is full,
+// so that the publishing side sees the failure. Batches are answered with the
+// outcome of each entry so that one bad message doesn't fail its neighbours.
+func (r *NetworkReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxNetworkMessageBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid message: %v", err), http.StatusBadRequest)
+		return
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		r.serveBatch(w, trimmed)
+		return
+	}
+	var message Message
+	err = json.Unmarshal(data, &message)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid message: %v", err), http.StatusBadRequest)
+		return
+	}
+	err = r.accept(message)
+	if errors.Is(err, errReceiverFull) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *NetworkReceiver) serveBatch(w http.ResponseWriter, data []byte) {
+	var messages []Message
+	err := json.Unmarshal(data, &messages)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid message batch: %v", err), http.StatusBadRequest)
+		return
+	}
+	result := batchResponse{Errors: make([]string, len(messages))}
+	for i, m := range messages {
+		err := r.accept(m)
+		if err != nil {
+			result.Errors[i] = err.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+var errReceiverFull = errors.New("receiver buffer full")
+
+// accept validates a message and adds it to the buffer without blocking.
+func (r *NetworkReceiver) accept(m Message) error {
+	err := validateMessage(m)
+	if err != nil {
+		return err
+	}
+	select {
+	case r.messages <- m:
+		return nil
+	default:
+		return errReceiverFull
+	}
+}
+
+// Receive blocks until a message is available or the context is done.
+// It then returns all messages received over HTTP up to that point.
+func (r *NetworkReceiver) Receive(ctx context.Context) ([]Message, error) {
+	return receiveAvailable(ctx, r.messages)
+}
+
+// Drain returns the messages already received over HTTP, without waiting for more.
+func (r *NetworkReceiver) Drain() ([]Message, error) {
+	return drainAvailable(r.messages, nil), nil
+}
+
+// validateMessage checks that a message received from outside the process
+// carries enough information to be stored.
+func validateMessage(m Message) error {
+	if m.Publisher == "" {
+		return errors.New("invalid message: missing publisher")
+	}
+	if m.Order < 0 {
+		return fmt.Errorf("invalid message: negative order %d", m.Order)
+	}
+	return nil
+}
+
+// receiveAvailable waits for a message on the channel, then collects every
+// other message already waiting behind it. It returns nothing if the context
+// is done or the channel is closed before any message arrives.
+func receiveAvailable(ctx context.Context, ch <-chan Message) ([]Message, error) {
 	var messages []Message
+	select {
+	case <-ctx.Done():
+		return messages, nil
+	case msg, ok := <-ch:
+		if !ok {
+			return messages, nil
+		}
+		messages = append(messages, msg)
+	}
+	return drainAvailable(ch, messages), nil
+}
+
+// drainAvailable appends every message already waiting on the channel to messages.
+func drainAvailable(ch <-chan Message, messages []Message) []Message {
 	for {
 		select {
-		case <-ctx.Done():
-			return messages, nil
-		case msg, ok := <-r.messages:
+		case msg, ok := <-ch:
 			if !ok {
-				return messages, nil
+				return messages
 			}
 			messages = append(messages, msg)
+		default:
+			return messages
 		}
 	}
 }
@@ -50,31 +250,138 @@ func (s *Subscriber) Receive(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	var convertedMessages []store.Message
-	for _, msg := range messages {
-		convertedMessages = append(convertedMessages, store.Message{
-			Publisher: msg.Publisher,
-			Order:     msg.Order,
-			Content:   msg.Content,
-		})
+	return s.process(ctx, messages)
+}
+
+// Run receives messages continuously, saving them to the [Store] and passing them
+// to any registered [Handler] as they arrive, until the context is done.
+// It then drains messages still buffered in the [Receiver] for up to
+// DrainTimeout, processes them, and returns nil.
+// Run stops early and returns an error if the Receiver or Store fails, or if a
+// Handler fails and no error function was registered with OnError.
+func (s *Subscriber) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		err := s.Receive(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return s.drain(ctx)
+}
+
+// drain processes whatever the [Receiver] still has buffered after the
+// Subscriber has been asked to stop. A [Drainer] is drained until it holds
+// nothing more; other Receivers are received from until one returns nothing.
+func (s *Subscriber) drain(ctx context.Context) error {
+	timeout := s.DrainTimeout
+	if timeout == 0 {
+		timeout = DefaultDrainTimeout
+	}
+	drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	receive := s.receiver.Receive
+	if d, ok := s.receiver.(Drainer); ok {
+		receive = func(context.Context) ([]Message, error) { return d.Drain() }
+	}
+	for drainCtx.Err() == nil {
+		messages, err := receive(drainCtx)
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		err = s.process(drainCtx, messages)
+		if err != nil {
+			return err
+		}
 	}
-	err = s.Store.Save(convertedMessages)
+	return nil
+}
+
+// process saves messages to the [Store] and then hands them to each [Handler].
+func (s *Subscriber) process(ctx context.Context, messages []Message) error {
+	messages, err := s.filtered(messages)
 	if err != nil {
 		return err
 	}
+	if len(messages) == 0 {
+		return nil
+	}
+	if s.Store != nil {
+		var convertedMessages []store.Message
+		for _, msg := range messages {
+			convertedMessages = append(convertedMessages, toStoreMessage(msg))
+		}
+		err := s.Store.Save(convertedMessages)
+		if err != nil {
+			return err
+		}
+	}
+	for _, msg := range messages {
+		for _, h := range s.handlers {
+			err := h(ctx, msg)
+			if err == nil {
+				continue
+			}
+			if s.onError == nil {
+				return fmt.Errorf("handling message %d from %s: %w", msg.Order, msg.Publisher, err)
+			}
+			s.onError(msg, err)
+		}
+	}
 	return nil
 }
 
-// EventBridgeReceiver
+// filtered returns the messages matching the Subscriber's filter, if it has one.
+func (s *Subscriber) filtered(messages []Message) ([]Message, error) {
+	if s.filter == nil {
+		return messages, nil
+	}
+	var matched []Message
+	for _, msg := range messages {
+		ok, err := s.filter.MatchMessage(msg)
+		if err != nil {
+			return nil, fmt.Errorf("filtering message %d from %s: %w", msg.Order, msg.Publisher, err)
+		}
+		if ok {
+			matched = append(matched, msg)
+		}
+	}
+	return matched, nil
+}
+
+// EventBridgeReceiver is a Receiver for the single event an AWS Lambda
+// function is invoked with by an EventBridge Rule.
 type EventBridgeReceiver struct {
-	event events.EventBridgeEvent
+	event     events.EventBridgeEvent
+	decode    Decoder
+	delivered bool
 }
 
-func NewEventBridgeSubscriber(event events.EventBridgeEvent, store store.Store) *Subscriber {
+// EventBridgeReceiverOptions are functional options for configuring an [EventBridgeReceiver].
+type EventBridgeReceiverOptions func(*EventBridgeReceiver)
+
+// WithDecoder is a functional option specifying how an [EventBridgeReceiver]
+// decodes the message from its event, inverting the [Transform] the publisher
+// applied. By default the detail may be either a JSON [Message], as sent with
+// [DefaultTransform], or an [Envelope], as sent with [EnvelopeTransform].
+func WithDecoder(d Decoder) EventBridgeReceiverOptions {
+	return func(r *EventBridgeReceiver) {
+		r.decode = d
+	}
+}
+
+func NewEventBridgeSubscriber(event events.EventBridgeEvent, store store.Store, opts ...EventBridgeReceiverOptions) *Subscriber {
+	receiver := &EventBridgeReceiver{
+		event:  event,
+		decode: FirstDecoder(DefaultDecoder, EnvelopeDecoder),
+	}
+	for _, opt := range opts {
+		opt(receiver)
+	}
 	return &Subscriber{
-		receiver: &EventBridgeReceiver{
-			event: event,
-		},
-		Store: store,
+		receiver: receiver,
+		Store:    store,
 	}
 }
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
@@ -17,6 +19,21 @@ type Transport interface {
 	Publish(Message) error
 }
 
+// ContextTransport is a [Transport] that honours the deadline and cancellation
+// of a [context.Context] while delivering a message.
+type ContextTransport interface {
+	Transport
+	PublishContext(context.Context, Message) error
+}
+
+// BatchTransport is a [Transport] that can deliver many messages in one round trip.
+// PublishBatch returns one error per message, in the same order as the messages
+// it was given, with a nil error for every message that was delivered.
+type BatchTransport interface {
+	Transport
+	PublishBatch(context.Context, []Message) []error
+}
+
 // WithTransport is a functional option specifying that a [Publisher]
 // should use the given [Transport] to deliver messages.
 func WithTransport(t Transport) PublisherOptions {
@@ -38,8 +55,28 @@ func NewMemoryTransport() *InMemoryTransport {
 
 // Publish sends a message to the InMemoryTransport by sending a message on the channel
 func (t *InMemoryTransport) Publish(m Message) error {
-	t.messages <- m
-	return nil
+	return t.PublishContext(context.Background(), m)
+}
+
+// PublishContext sends a message on the channel, giving up if the context
+// is done before there is room for it.
+func (t *InMemoryTransport) PublishContext(ctx context.Context, m Message) error {
+	select {
+	case t.messages <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PublishBatch sends every message to the InMemoryTransport.
+// It only fails for messages it could not send before the context was done.
+func (t *InMemoryTransport) PublishBatch(ctx context.Context, messages []Message) []error {
+	errs := make([]error, len(messages))
+	for i, m := range messages {
+		errs[i] = t.PublishContext(ctx, m)
+	}
+	return errs
 }
 
 // GetReceiver returns a Receiver that can be used to receive messages from the InMemoryTransport
@@ -51,38 +88,122 @@ func (t *InMemoryTransport) GetReceiver() *InMemoryReceiver {
 // NetworkTransport is a Transport that ships messages over the Network
 type NetworkTransport struct {
 	endpoint string
+	client   *http.Client
+}
+
+// NetworkTransportOptions are functional options for configuring a NetworkTransport
+type NetworkTransportOptions func(*NetworkTransport)
+
+// DefaultNetworkTimeout bounds each request made by a NetworkTransport
+// unless overridden with [WithTimeout] or [WithHTTPClient].
+const DefaultNetworkTimeout = 10 * time.Second
+
+// WithHTTPClient is a functional option specifying the [http.Client] a NetworkTransport sends requests with
+func WithHTTPClient(client *http.Client) NetworkTransportOptions {
+	return func(t *NetworkTransport) {
+		t.client = client
+	}
+}
+
+// WithTimeout is a functional option specifying how long a NetworkTransport waits for each request
+func WithTimeout(timeout time.Duration) NetworkTransportOptions {
+	return func(t *NetworkTransport) {
+		t.client = &http.Client{Timeout: timeout}
+	}
 }
 
 // WithNetworkTransport is a functional option specifying that a [Publisher]
 // should use the given endpoint to deliver messages over the network
-func WithNetworkTransport(endpoint string) PublisherOptions {
+func WithNetworkTransport(endpoint string, opts ...NetworkTransportOptions) PublisherOptions {
+	transport := &NetworkTransport{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: DefaultNetworkTimeout},
+	}
+	for _, opt := range opts {
+		opt(transport)
+	}
 	return func(p *Publisher) {
-		p.Transport = &NetworkTransport{endpoint: endpoint}
+		p.Transport = transport
 	}
 }
 
 // Publish sends a message to the NetworkTransport by sending an HTTP POST Request
 func (t *NetworkTransport) Publish(m Message) error {
+	return t.PublishContext(context.Background(), m)
+}
+
+// PublishContext sends a message to the NetworkTransport by sending an HTTP POST Request
+// that is abandoned if the context is done before it completes
+func (t *NetworkTransport) PublishContext(ctx context.Context, m Message) error {
 	data, err := json.Marshal(m)
 	if err != nil {
-		panic(err)
-	}
-	buf := bytes.NewBuffer(data)
-	req, err := http.NewRequest("POST", t.endpoint, buf)
-	if err != nil {
-		panic(err)
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := t.post(ctx, data)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 	return nil
 }
 
+// PublishBatch sends all messages to the NetworkTransport as a JSON array in a
+// single HTTP POST Request. A [NetworkReceiver] reports which entries it rejected;
+// if the request as a whole fails, every entry reports that failure.
+func (t *NetworkTransport) PublishBatch(ctx context.Context, messages []Message) []error {
+	errs := make([]error, len(messages))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return fail(err)
+	}
+	resp, err := t.post(ctx, data)
+	if err != nil {
+		return fail(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fail(fmt.Errorf("unexpected status code: %d", resp.StatusCode))
+	}
+	var result batchResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return fail(fmt.Errorf("invalid batch response: %w", err))
+	}
+	if len(result.Errors) != len(messages) {
+		return fail(fmt.Errorf("invalid batch response: %d results for %d messages", len(result.Errors), len(messages)))
+	}
+	for i, msg := range result.Errors {
+		if msg != "" {
+			errs[i] = errors.New(msg)
+		}
+	}
+	return errs
+}
+
+// batchResponse is the body a [NetworkReceiver] replies with when it is sent a batch.
+// Errors holds one entry per message, empty if the message was accepted.
+type batchResponse struct {
+	Errors []string `json:"errors"`
+}
+
+func (t *NetworkTransport) post(ctx context.Context, data []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return t.client.Do(req)
+}
+
 // EventBridgeTransport is a Transport that ships messages via AWS EventBridge
 type EventBridgeClient interface {
 	PutEvents(ctx context.Context, events *eventbridge.PutEventsInput, opts ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
@@ -116,6 +237,76 @@ var DefaultTransform = func(m Message) (string, error) {
 	return string(data), nil
 }
 
+// Decoder inverts a [Transform], recovering the Message from the detail of
+// the EventBridge event the Transform produced. Each Transform shipped with
+// rivulet has a Decoder paired with it, and a publisher using a custom
+// Transform should give its receivers a Decoder to match with [WithDecoder].
+type Decoder func(detail []byte) (Message, error)
+
+// DefaultDecoder inverts [DefaultTransform], decoding the detail as a JSON [Message].
+var DefaultDecoder = func(detail []byte) (Message, error) {
+	var m Message
+	err := json.Unmarshal(detail, &m)
+	if err != nil {
+		return Message{}, err
+	}
+	return m, validateMessage(m)
+}
+
+// Envelope is the event detail produced by [EnvelopeTransform]. Detail
+// holds the message encoded as JSON, and Type names the kind of event, so
+// that EventBridge Rules can match on it without knowing about messages.
+type Envelope struct {
+	Detail string `json:"detail"`
+	Type   string `json:"type"`
+}
+
+// EnvelopeTransform returns a [Transform] that wraps each message in an
+// [Envelope] of the given type. It is inverted by [EnvelopeDecoder].
+func EnvelopeTransform(eventType string) Transform {
+	return func(m Message) (string, error) {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return "", err
+		}
+		out, err := json.Marshal(Envelope{Detail: string(data), Type: eventType})
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+}
+
+// EnvelopeDecoder inverts [EnvelopeTransform], whatever its type.
+var EnvelopeDecoder = func(detail []byte) (Message, error) {
+	var e Envelope
+	err := json.Unmarshal(detail, &e)
+	if err != nil {
+		return Message{}, err
+	}
+	if e.Detail == "" {
+		return Message{}, errors.New("event detail is not an envelope")
+	}
+	return DefaultDecoder([]byte(e.Detail))
+}
+
+// FirstDecoder returns a [Decoder] that tries each of the decoders in turn,
+// returning the first message decoded, for receivers of events from
+// publishers using different transforms.
+func FirstDecoder(decoders ...Decoder) Decoder {
+	return func(detail []byte) (Message, error) {
+		var errs []error
+		for _, decode := range decoders {
+			m, err := decode(detail)
+			if err == nil {
+				return m, nil
+			}
+			errs = append(errs, err)
+		}
+		return Message{}, fmt.Errorf("no decoder understood the event detail: %w", errors.Join(errs...))
+	}
+}
+
 // WithDetailType is a functional option specifying the DetailType of the EventBridgeTransport
 func WithDetailType(detailType string) EventBridgeTransportOptions {
 	return func(t *EventBridgeTransport) {
@@ -163,6 +354,9 @@ func WithEventBridgeTransport(eventBridge EventBridgeClient, opts ...EventBridge
 	}
 }
 
+// maxEventBridgeBatch is the maximum number of entries accepted by a single PutEvents call.
+const maxEventBridgeBatch = 10
+
 // Publish sends a message to the specified AWS EventBus via the EventBridgeTransport
 // Note that the message is transformed before being sent and the default transform
 // is to simply marshal the message to JSON. This can be overridden by providing
@@ -171,33 +365,83 @@ func WithEventBridgeTransport(eventBridge EventBridgeClient, opts ...EventBridge
 // to match this event and route it to the appropriate target. Successfully delivery
 // of the event to the EventBus is no indication that the event will be routed to the target.
 func (t *EventBridgeTransport) Publish(message Message) error {
+	return t.PublishContext(context.Background(), message)
+}
+
+// PublishContext behaves like Publish, passing the context on to the EventBridge client
+// so that the call is abandoned if the context is done before it completes.
+func (t *EventBridgeTransport) PublishContext(ctx context.Context, message Message) error {
+	return t.PublishBatch(ctx, []Message{message})[0]
+}
+
+// PublishBatch sends messages to the specified AWS EventBus, packing up to ten
+// messages into each PutEvents call. Messages are transformed exactly as they are
+// by Publish. A message that fails to transform, or that EventBridge reports as a
+// failed entry, gets its own error without affecting the rest of the batch.
+func (t *EventBridgeTransport) PublishBatch(ctx context.Context, messages []Message) []error {
+	errs := make([]error, len(messages))
+	var entries []types.PutEventsRequestEntry
+	var indexes []int
+	for i, m := range messages {
+		entry, err := t.entry(m)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		entries = append(entries, entry)
+		indexes = append(indexes, i)
+	}
+	for start := 0; start < len(entries); start += maxEventBridgeBatch {
+		end := min(start+maxEventBridgeBatch, len(entries))
+		t.putEvents(ctx, entries[start:end], indexes[start:end], errs)
+	}
+	return errs
+}
+
+// entry transforms a message into a PutEvents request entry.
+func (t *EventBridgeTransport) entry(message Message) (types.PutEventsRequestEntry, error) {
 	detail, err := t.transform(message)
 	if err != nil {
-		return err
+		return types.PutEventsRequestEntry{}, err
 	}
 	if detail == "" {
-		return fmt.Errorf("message transform returned an empty string")
-	}
-	putEventsInput := &eventbridge.PutEventsInput{
-		Entries: []types.PutEventsRequestEntry{
-			{
-				Detail:       aws.String(detail),
-				DetailType:   aws.String(t.detailType),
-				Source:       aws.String(t.source),
-				EventBusName: aws.String(t.eventBusName),
-			},
-		},
-	}
-	resp, err := t.EventBridge.PutEvents(context.Background(), putEventsInput)
+		return types.PutEventsRequestEntry{}, fmt.Errorf("message transform returned an empty string")
+	}
+	return types.PutEventsRequestEntry{
+		Detail:       aws.String(detail),
+		DetailType:   aws.String(t.detailType),
+		Source:       aws.String(t.source),
+		EventBusName: aws.String(t.eventBusName),
+	}, nil
+}
+
+// putEvents sends a single PutEvents call, recording the outcome of entries[i]
+// in errs[indexes[i]].
+func (t *EventBridgeTransport) putEvents(ctx context.Context, entries []types.PutEventsRequestEntry, indexes []int, errs []error) {
+	fail := func(err error) {
+		for _, idx := range indexes {
+			errs[idx] = err
+		}
+	}
+	resp, err := t.EventBridge.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: entries,
+	})
 	if err != nil {
-		return err
+		fail(err)
+		return
+	}
+	if resp.FailedEntryCount == 0 {
+		return
 	}
-	if resp.FailedEntryCount > 0 {
-		if len(resp.Entries) > 0 {
-			return fmt.Errorf("failed to publish events:%s, %s",
-				*(resp.Entries[0].ErrorCode),
-				*(resp.Entries[0].ErrorMessage))
+	if len(resp.Entries) != len(entries) {
+		fail(fmt.Errorf("failed to publish events: %d of %d entries failed", resp.FailedEntryCount, len(entries)))
+		return
+	}
+	for i, result := range resp.Entries {
+		if result.ErrorCode != nil {
+			errs[indexes[i]] = fmt.Errorf("failed to publish events:%s, %s",
+				aws.ToString(result.ErrorCode),
+				aws.ToString(result.ErrorMessage))
 		}
 	}
-	return nil
 }